@@ -0,0 +1,247 @@
+package dbhelper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/linlexing/datatable.go"
+	"reflect"
+)
+
+//ParamLimiter is implemented by the MetaHelper that limit the number of the params of one statement
+type ParamLimiter interface {
+	MaxParams() int
+}
+
+//the rows of one INSERT statement when the SaveOptions.InsertBatchSize is 0
+const DefaultInsertBatchSize = 100
+
+//SaveOptions is the options of the insert of the SaveChange,set by the SetSaveOptions
+type SaveOptions struct {
+	//the max rows of one INSERT statement,0 is the DefaultInsertBatchSize,1(or < 0) insert one row per statement.
+	//it's reduced to the params limit of the MetaHelper(ParamLimiter)
+	InsertBatchSize int
+	//use the BulkLoader of the MetaHelper when the number of the inserted rows reach it,0 never
+	BulkLoadThreshold int
+}
+
+//SetSaveOptions set the SaveOptions,the DBHelper returned by Begin or WithContext after it inherit them.
+//it shouldn't be called concurrently with the SaveChange
+func (h *DBHelper) SetSaveOptions(opts SaveOptions) {
+	h.saveOptions = opts
+}
+
+//BulkLoader is implemented by the MetaHelper that can load the rows fast(e.g. COPY of the postgres),
+//it run on the DBHelper bind to the MetaHelper,return the number of the rows loaded.
+//return the ErrBulkLoadUnsupported if can't load now,the rows are inserted by the multi-row INSERT
+type BulkLoader interface {
+	BulkLoad(ctx context.Context, tablename string, cols []string, rows [][]interface{}) (int64, error)
+}
+
+var ErrBulkLoadUnsupported = errors.New("the bulk load is unsupported")
+
+//the rows of one INSERT statement
+func (h *DBHelper) insertBatchSize(numCols int) int {
+	size := h.saveOptions.InsertBatchSize
+	if size == 0 {
+		size = DefaultInsertBatchSize
+	}
+	if size < 1 {
+		size = 1
+	}
+	if pl, ok := h.metaHelper.(ParamLimiter); ok && numCols > 0 && size*numCols > pl.MaxParams() {
+		size = pl.MaxParams() / numCols
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+//insert the rows,by the BulkLoader if bulk and the MetaHelper is a BulkLoader,else by the multi-row INSERT
+func insertRows(ctx context.Context, h *DBHelper, table *DataTable, rows []*datatable.DataRow, bulk bool) (rcount int64, err error) {
+	if err = setVersion(table, rows, true); err != nil {
+		return
+	}
+	if rows, rcount, err = insertGenerated(ctx, h, table, rows); err != nil {
+		return
+	}
+	if len(rows) == 0 {
+		return
+	}
+	cols := writableColumns(table)
+	//计算列不能插入
+	data := func(r *datatable.DataRow) []interface{} {
+		if len(cols) == len(table.Columns) {
+			return r.Data
+		}
+		return columnValues(table, r.Data, cols)
+	}
+	if loader, ok := h.metaHelper.(BulkLoader); ok && bulk {
+		values := make([][]interface{}, len(rows))
+		for i, r := range rows {
+			values[i] = data(r)
+		}
+		err = h.trace(ctx, "bulkload", table.TableName, nil, func(ctx context.Context) (int64, error) {
+			n, err := loader.BulkLoad(ctx, table.TableName, cols, values)
+			rcount += n
+			return n, err
+		})
+		if !errors.Is(err, ErrBulkLoadUnsupported) {
+			return
+		}
+		err = nil
+	}
+	size := h.insertBatchSize(len(cols))
+	//批量语句和最后不足一批的语句
+	stmts := map[int]*sql.Stmt{}
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		strSql, err := h.ConvertSql(buildInsertRowsSql(table.TableName, cols, end-start), nil)
+		if err != nil {
+			return rcount, err
+		}
+		stmt, ok := stmts[end-start]
+		if !ok {
+			if stmt, err = h.prepareTx(ctx, strSql); err != nil {
+				return rcount, h.sqlError("[prepare]\n"+strSql, err)
+			}
+			stmts[end-start] = stmt
+		}
+		args := make([]interface{}, 0, (end-start)*len(cols))
+		for _, r := range rows[start:end] {
+			args = append(args, data(r)...)
+		}
+		if _, err = h.execStmt(ctx, stmt, strSql, args); err != nil {
+			return rcount, h.sqlError(strSql, err, args...)
+		}
+		rcount += int64(end - start)
+	}
+	return
+}
+
+//insert the rows that some generated column is nil one by one,the generated columns with nil value
+//are omitted and the generated values are written back to the row.return the other rows.
+//the computed columns are always omitted,and written back if the MetaHelper is a ReturningBuilder.
+//the columns with the Default,NullAsDefault and nil value are omitted too,the default values are
+//written back only if the MetaHelper is a ReturningBuilder
+func insertGenerated(ctx context.Context, h *DBHelper, table *DataTable, rows []*datatable.DataRow) (others []*datatable.DataRow, rcount int64, err error) {
+	names := table.ColumnNames()
+	rb, returning := h.metaHelper.(ReturningBuilder)
+	hasGenerated := false
+	for _, c := range table.Columns {
+		if c.Generated() || returning && c.Computed != "" || c.NullAsDefault && c.Default != "" {
+			hasGenerated = true
+			break
+		}
+	}
+	if !hasGenerated {
+		return rows, 0, nil
+	}
+	stmts := map[string]*sql.Stmt{}
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+	for _, r := range rows {
+		cols, retCols := []string{}, []string{}
+		defaulted := false
+		for i, c := range table.Columns {
+			switch {
+			case c.Computed != "":
+				if returning {
+					retCols = append(retCols, names[i])
+				}
+			case c.Generated() && r.Data[i] == nil:
+				retCols = append(retCols, names[i])
+			case c.NullAsDefault && c.Default != "" && r.Data[i] == nil:
+				if returning {
+					retCols = append(retCols, names[i])
+				}
+				defaulted = true
+			default:
+				cols = append(cols, names[i])
+			}
+		}
+		if len(retCols) == 0 && !defaulted {
+			others = append(others, r)
+			continue
+		}
+		var strSql string
+		switch {
+		case returning:
+			strSql = rb.BuildInsertReturningSql(table.TableName, cols, retCols)
+		case len(retCols) <= 1:
+			strSql = buildInsertColumnsSql(table.TableName, cols)
+		default:
+			return nil, rcount, fmt.Errorf("the MetaHelper can't return the generated columns %v of the table %s", retCols, table.TableName)
+		}
+		if strSql, err = h.ConvertSql(strSql, nil); err != nil {
+			return
+		}
+		stmt, ok := stmts[strSql]
+		if !ok {
+			if stmt, err = h.prepareTx(ctx, strSql); err != nil {
+				return nil, rcount, h.sqlError("[prepare]\n"+strSql, err)
+			}
+			stmts[strSql] = stmt
+		}
+		args := columnValues(table, r.Data, cols)
+		if returning {
+			dest := make([]interface{}, len(retCols))
+			for i, c := range retCols {
+				dest[i] = table.Columns[table.ColumnIndex(c)].PtrValue()
+			}
+			if err = h.trace(ctx, "queryrow", strSql, args, func(ctx context.Context) (int64, error) {
+				return 1, stmt.QueryRowContext(ctx, args...).Scan(dest...)
+			}); err != nil {
+				return nil, rcount, h.sqlError(strSql, err, args...)
+			}
+			for i, c := range retCols {
+				r.Data[table.ColumnIndex(c)] = reflect.ValueOf(dest[i]).Elem().Interface()
+			}
+		} else {
+			var result sql.Result
+			if result, err = h.execStmt(ctx, stmt, strSql, args); err != nil {
+				return nil, rcount, h.sqlError(strSql, err, args...)
+			}
+			if len(retCols) == 1 {
+				var id int64
+				if id, err = result.LastInsertId(); err != nil {
+					return
+				}
+				r.Data[table.ColumnIndex(retCols[0])] = id
+			}
+		}
+		rcount++
+	}
+	return
+}
+
+//BulkInsert insert the added rows(the InsertRows of the GetChange) of the table in a transaction,
+//by the BulkLoader of the MetaHelper if it is,else by the multi-row INSERT.
+//the updated and deleted rows are ignored
+func (h *DBHelper) BulkInsert(table *DataTable) (int64, error) {
+	return h.BulkInsertContext(h.context(), table)
+}
+func (h *DBHelper) BulkInsertContext(ctx context.Context, table *DataTable) (rcount int64, err error) {
+	rows := table.GetChange().InsertRows
+	if len(rows) == 0 {
+		return
+	}
+	err = h.InTxContext(ctx, func(th *DBHelper) (err error) {
+		rcount, err = insertRows(ctx, th, table, rows, true)
+		return
+	}, nil)
+	return
+}
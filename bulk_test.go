@@ -0,0 +1,169 @@
+package dbhelper
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"github.com/linlexing/datatable.go"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_insertBatchSize(t *testing.T) {
+	cases := []struct {
+		batch, cols, size int
+	}{
+		{0, 10, 99},
+		{0, 2, 100},
+		{1, 10, 1},
+		{-1, 10, 1},
+		{100, 10, 99},
+		{50, 10, 50},
+		{100, 2000, 1},
+	}
+	for _, c := range cases {
+		h := NewDBHelper(fakeDriverName, "")
+		h.SetSaveOptions(SaveOptions{InsertBatchSize: c.batch})
+		if size := h.insertBatchSize(c.cols); size != c.size {
+			t.Errorf("batch %d,cols %d got %d,expect %d", c.batch, c.cols, size, c.size)
+		}
+	}
+}
+func Test_buildInsertRowsSql(t *testing.T) {
+	expect := "INSERT INTO t(\n\ta,\n\tb)VALUES\n\t({{ph}},{{ph}}),\n\t({{ph}},{{ph}})"
+	if got := buildInsertRowsSql("t", []string{"a", "b"}, 2); got != expect {
+		t.Errorf("got %q,expect %q", got, expect)
+	}
+	if got := buildInsertRowsSql("t", []string{"a"}, 1); got != buildInsertColumnsSql("t", []string{"a"}) {
+		t.Errorf("one row got %q", got)
+	}
+}
+func Test_mysqlBulkLoad(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeMysqlDriverName)
+	defer h.Close()
+	newTable := func() *DataTable {
+		table := NewDataTable("t")
+		table.AddColumn(NewDataColumn("a", datatable.Int64, 0, true))
+		table.AddColumn(NewDataColumn("b", datatable.String, 0, false))
+		table.AddValues(int64(1), "x\ty")
+		table.AddValues(int64(2), nil)
+		return table
+	}
+	//没有设置reader时用多行insert
+	if _, err := h.BulkInsert(newTable()); err != nil {
+		t.Fatal(err)
+	}
+	sqls, _ := fakeStatements(fakeReset())
+	if expect := []string{"INSERT INTO t( a, b)VALUES (?,?), (?,?)"}; !reflect.DeepEqual(sqls, expect) {
+		t.Errorf("got %q,expect %q", sqls, expect)
+	}
+
+	handlers := map[string]func() io.Reader{}
+	MysqlRegisterReaderHandler = func(name string, handler func() io.Reader) { handlers[name] = handler }
+	MysqlDeregisterReaderHandler = func(name string) {}
+	defer func() {
+		MysqlRegisterReaderHandler, MysqlDeregisterReaderHandler = nil, nil
+	}()
+	if _, err := h.BulkInsert(newTable()); err != nil {
+		t.Fatal(err)
+	}
+	execs := fakeReset()
+	if len(execs) != 1 || len(handlers) != 1 {
+		t.Fatalf("got %v,handlers %d", execs, len(handlers))
+	}
+	for name, handler := range handlers {
+		expect := mysqlLoadDataSql(name, "t", []string{"a", "b"})
+		if execs[0].query != expect {
+			t.Errorf("got %q,expect %q", execs[0].query, expect)
+		}
+		data, err := io.ReadAll(handler())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := "1\tx\\ty\n2\t\\N\n"; string(data) != expect {
+			t.Errorf("got %q,expect %q", data, expect)
+		}
+	}
+}
+func Test_mysqlWriteLoadData(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tm := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := mysqlWriteLoadData(buf, [][]interface{}{{`a\b`, true, 1.5, tm, []byte("x\ny")}}); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "a\\\\b\t1\t1.5\t2024-01-02 03:04:05\tx\\ny\n"; buf.String() != expect {
+		t.Errorf("got %q,expect %q", buf.String(), expect)
+	}
+}
+func Test_insertGenerated(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	newTable := func(nullAsDefault bool) *DataTable {
+		table := NewDataTable("items")
+		table.AddColumn(NewDataColumn("id", datatable.Int64, 0, true)).SetGenerated(true)
+		table.AddColumn(NewDataColumn("name", datatable.String, 0, true))
+		status := table.AddColumn(NewDataColumn("status", datatable.String, 0, false))
+		status.Default = "'new'"
+		status.NullAsDefault = nullAsDefault
+		table.SetPK("id")
+		table.AddValues(nil, "a", nil)
+		table.AddValues(int64(10), "b", "x")
+		return table
+	}
+	//sqlite用RETURNING返回生成的主键,nil值的status写入NULL
+	h := fakeOpen(t, fakeDriverName)
+	defer h.Close()
+	fakeResult("INSERT INTO items(name,status)VALUES(?,?) RETURNING id", []string{"id"},
+		[]driver.Value{int64(6)})
+	table := newTable(false)
+	rows := table.GetChange().InsertRows
+	if _, err := h.SaveChange(table); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []interface{}{int64(6), "a", nil}; !reflect.DeepEqual(rows[0].Data, expect) {
+		t.Errorf("got %v,expect %v", rows[0].Data, expect)
+	}
+	fakeReset()
+
+	//NullAsDefault的列用缺省值,并返回
+	fakeResult("INSERT INTO items(name)VALUES(?) RETURNING id,status", []string{"id", "status"},
+		[]driver.Value{int64(7), "new"})
+	table = newTable(true)
+	rows = table.GetChange().InsertRows
+	if _, err := h.SaveChange(table); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []interface{}{int64(7), "a", "new"}; !reflect.DeepEqual(rows[0].Data, expect) {
+		t.Errorf("got %v,expect %v", rows[0].Data, expect)
+	}
+	if expect := []interface{}{int64(10), "b", "x"}; !reflect.DeepEqual(rows[1].Data, expect) {
+		t.Errorf("got %v,expect %v", rows[1].Data, expect)
+	}
+	table.AcceptChange()
+	if n := table.GetChange().RowCount; n != 0 {
+		t.Errorf("got %d changes after AcceptChange", n)
+	}
+	sqls, _ := fakeStatements(fakeReset())
+	if expect := []string{"INSERT INTO items( id, name, status)VALUES( ?, ?, ?)"}; !reflect.DeepEqual(sqls, expect) {
+		t.Errorf("got %q,expect %q", sqls, expect)
+	}
+
+	//mysql用LastInsertId,缺省值不能返回
+	hm := fakeOpen(t, fakeMysqlDriverName)
+	defer hm.Close()
+	table = newTable(true)
+	rows = table.GetChange().InsertRows
+	if _, err := hm.SaveChange(table); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []interface{}{int64(1), "a", nil}; !reflect.DeepEqual(rows[0].Data, expect) {
+		t.Errorf("got %v,expect %v", rows[0].Data, expect)
+	}
+	sqls, _ = fakeStatements(fakeReset())
+	if expect := []string{"INSERT INTO items( name)VALUES( ?)", "INSERT INTO items( id, name, status)VALUES( ?, ?, ?)"}; !reflect.DeepEqual(sqls, expect) {
+		t.Errorf("got %q,expect %q", sqls, expect)
+	}
+}
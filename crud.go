@@ -0,0 +1,212 @@
+package dbhelper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//the values of one row,the columns in the order of the table
+type rowValues struct {
+	table  *DataTable
+	cols   []string
+	values map[string]interface{}
+	//the omitempty fields with the zero value
+	omitted map[string]bool
+}
+
+func (r *rowValues) args(cols []string) []interface{} {
+	rev := make([]interface{}, len(cols))
+	for i, c := range cols {
+		rev[i] = r.values[c]
+	}
+	return rev
+}
+
+//the columns to insert,the omitted and the generated columns with the zero value are skipped
+func (r *rowValues) insertColumns() []string {
+	rev := []string{}
+	for _, c := range r.cols {
+		if r.omitted[c] || r.table.Columns[r.table.ColumnIndex(c)].Generated() && isZeroValue(r.values[c]) {
+			continue
+		}
+		rev = append(rev, c)
+	}
+	return rev
+}
+
+//the columns to update,the omitted columns are skipped
+func (r *rowValues) updateColumns() []string {
+	rev := []string{}
+	for _, c := range r.cols {
+		if !r.omitted[c] {
+			rev = append(rev, c)
+		}
+	}
+	return rev
+}
+
+//the primary key columns,all of them must in the values
+func (r *rowValues) pkColumns() ([]string, error) {
+	if !r.table.HasPrimaryKey() {
+		return nil, fmt.Errorf("the table %q hasn't primary key", r.table.TableName)
+	}
+	for _, pk := range r.table.PK {
+		if _, ok := r.values[pk]; !ok {
+			return nil, fmt.Errorf("the primary key column %q of the table %q not found in the values", pk, r.table.TableName)
+		}
+	}
+	return r.table.PK, nil
+}
+func isZeroValue(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
+
+//get the table struct(cached) and map the struct(or map) values to the table columns,the name equal
+//the column first,then case-insensitive(error if more than one).the name not in the table is ignored
+func (h *DBHelper) rowValues(ctx context.Context, tablename string, v interface{}) (*rowValues, error) {
+	params, err := NamedParams(v)
+	if err != nil {
+		return nil, err
+	}
+	table, err := h.cachedTable(ctx, tablename)
+	if err != nil {
+		return nil, err
+	}
+	lowerNames := map[string][]string{}
+	for name := range params {
+		lower := strings.ToLower(name)
+		lowerNames[lower] = append(lowerNames[lower], name)
+	}
+	rev := &rowValues{table: table, values: map[string]interface{}{}, omitted: map[string]bool{}}
+	omitted := omittedParams(v)
+	for _, col := range writableColumns(table) {
+		name := col
+		if _, ok := params[col]; !ok {
+			names := lowerNames[strings.ToLower(col)]
+			if len(names) == 0 {
+				continue
+			}
+			if len(names) > 1 {
+				sort.Strings(names)
+				return nil, fmt.Errorf("the %T has more than one name of the column %q:%s", v, col, strings.Join(names, ","))
+			}
+			name = names[0]
+		}
+		rev.cols = append(rev.cols, col)
+		rev.values[col] = params[name]
+		if omitted[name] {
+			rev.omitted[col] = true
+		}
+	}
+	if len(rev.cols) == 0 {
+		return nil, fmt.Errorf("the %T hasn't any column of the table %q", v, tablename)
+	}
+	return rev, nil
+}
+
+//Insert insert a row into the table,v is the struct(the field use the db tag as the column name) or the map.
+//the field tagged omitempty and the generated column(auto increment...) with the zero value are skipped
+func (h *DBHelper) Insert(tablename string, v interface{}) (sql.Result, error) {
+	return h.InsertContext(h.context(), tablename, v)
+}
+func (h *DBHelper) InsertContext(ctx context.Context, tablename string, v interface{}) (sql.Result, error) {
+	row, err := h.rowValues(ctx, tablename, v)
+	if err != nil {
+		return nil, err
+	}
+	cols := row.insertColumns()
+	return h.ExecContext(ctx, buildInsertColumnsSql(tablename, cols), row.args(cols)...)
+}
+
+//Update update the row by the primary key,all the columns in v except the primary key
+//and the field tagged omitempty with the zero value are updated
+func (h *DBHelper) Update(tablename string, v interface{}) (sql.Result, error) {
+	return h.UpdateContext(h.context(), tablename, v)
+}
+func (h *DBHelper) UpdateContext(ctx context.Context, tablename string, v interface{}) (sql.Result, error) {
+	row, err := h.rowValues(ctx, tablename, v)
+	if err != nil {
+		return nil, err
+	}
+	return h.updateRow(ctx, row)
+}
+func (h *DBHelper) updateRow(ctx context.Context, row *rowValues) (sql.Result, error) {
+	pks, err := row.pkColumns()
+	if err != nil {
+		return nil, err
+	}
+	sets := nonKeyColumns(row.updateColumns(), pks)
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("no column to update of the table %q", row.table.TableName)
+	}
+	return h.ExecContext(ctx, buildUpdateColumnsSql(row.table.TableName, sets, pks), append(row.args(sets), row.args(pks)...)...)
+}
+
+//Delete delete the row by the primary key
+func (h *DBHelper) Delete(tablename string, v interface{}) (sql.Result, error) {
+	return h.DeleteContext(h.context(), tablename, v)
+}
+func (h *DBHelper) DeleteContext(ctx context.Context, tablename string, v interface{}) (sql.Result, error) {
+	row, err := h.rowValues(ctx, tablename, v)
+	if err != nil {
+		return nil, err
+	}
+	pks, err := row.pkColumns()
+	if err != nil {
+		return nil, err
+	}
+	return h.ExecContext(ctx, buildDeleteColumnsSql(tablename, pks), row.args(pks)...)
+}
+
+//Upsert insert the row,or update it if the primary key exists.
+//if the MetaHelper isn't a UpsertBuilder,update first and insert when no row updated in a transaction
+func (h *DBHelper) Upsert(tablename string, v interface{}) (sql.Result, error) {
+	return h.UpsertContext(h.context(), tablename, v)
+}
+func (h *DBHelper) UpsertContext(ctx context.Context, tablename string, v interface{}) (result sql.Result, err error) {
+	row, err := h.rowValues(ctx, tablename, v)
+	if err != nil {
+		return nil, err
+	}
+	pks, err := row.pkColumns()
+	if err != nil {
+		return nil, err
+	}
+	cols := row.insertColumns()
+	if builder, ok := h.metaHelper.(UpsertBuilder); ok {
+		return h.ExecContext(ctx, builder.BuildUpsertSql(tablename, cols, pks), row.args(cols)...)
+	}
+	err = h.InTxContext(ctx, func(th *DBHelper) (err error) {
+		if len(nonKeyColumns(row.updateColumns(), pks)) > 0 {
+			if result, err = th.updateRow(ctx, row); err != nil {
+				return
+			}
+			var iCount int64
+			if iCount, err = result.RowsAffected(); err != nil || iCount > 0 {
+				return
+			}
+		} else {
+			var exists bool
+			if exists, err = th.ExistsContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE %s",
+				tablename, strings.Join(pkWheres(pks), " AND ")), row.args(pks)...); err != nil || exists {
+				return
+			}
+		}
+		result, err = th.ExecContext(ctx, buildInsertColumnsSql(tablename, cols), row.args(cols)...)
+		return
+	}, nil)
+	return
+}
+
+//col = {{ph}} of every column
+func pkWheres(cols []string) []string {
+	rev := make([]string, len(cols))
+	for i, c := range cols {
+		rev[i] = fmt.Sprintf("%s = {{ph}}", c)
+	}
+	return rev
+}
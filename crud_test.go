@@ -0,0 +1,108 @@
+package dbhelper
+
+import (
+	"database/sql/driver"
+	"github.com/linlexing/datatable.go"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type crudUser struct {
+	ID    int64  `db:"id"`
+	Name  string `db:"name"`
+	Email string `db:"email,omitempty"`
+}
+
+//the statements and the args of the fakeExecs,the whitespace of the statement is compacted
+func fakeStatements(execs []fakeExec) ([]string, [][]driver.Value) {
+	sqls, args := []string{}, [][]driver.Value{}
+	for _, e := range execs {
+		sqls = append(sqls, strings.Join(strings.Fields(e.query), " "))
+		args = append(args, e.args)
+	}
+	return sqls, args
+}
+func Test_crud(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeDriverName)
+	defer h.Close()
+	table := NewDataTable("users")
+	table.AddColumn(NewDataColumn("id", datatable.Int64, 0, true)).SetGenerated(true)
+	table.AddColumn(NewDataColumn("name", datatable.String, 50, true))
+	table.AddColumn(NewDataColumn("email", datatable.String, 50, false))
+	table.SetPK("id")
+	h.tables.set("users", table)
+
+	if _, err := h.Insert("users", &crudUser{Name: "tom"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Update("users", &crudUser{ID: 1, Name: "jack"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Upsert("users", &crudUser{ID: 2, Name: "mary", Email: "m@x.com"}); err != nil {
+		t.Fatal(err)
+	}
+	//大小写不同的名称
+	if _, err := h.Delete("users", map[string]interface{}{"ID": int64(2)}); err != nil {
+		t.Fatal(err)
+	}
+	sqls, args := fakeStatements(fakeReset())
+	expect := []string{
+		"INSERT INTO users( name)VALUES( ?)",
+		"UPDATE users SET name = ? WHERE id = ?",
+		"INSERT INTO users(id,name,email)VALUES(?,?,?) ON CONFLICT(id) DO UPDATE SET name = excluded.name, email = excluded.email",
+		"DELETE FROM users WHERE id = ?",
+	}
+	if !reflect.DeepEqual(sqls, expect) {
+		t.Fatalf("got %q,expect %q", sqls, expect)
+	}
+	expectArgs := [][]driver.Value{
+		{"tom"},
+		{"jack", int64(1)},
+		{int64(2), "mary", "m@x.com"},
+		{int64(2)},
+	}
+	if !reflect.DeepEqual(args, expectArgs) {
+		t.Errorf("got %v,expect %v", args, expectArgs)
+	}
+
+	if _, err := h.Delete("users", map[string]interface{}{"Id": 1, "ID": 1}); err == nil {
+		t.Error("the ambiguous names should fail")
+	}
+	//失效后重新读取表结构,fake驱动没有注册结果
+	h.InvalidateTable("USERS")
+	if _, err := h.Delete("users", map[string]interface{}{"id": 1}); err == nil {
+		t.Error("the invalidated table should be read again")
+	}
+}
+func Test_structFieldsOptions(t *testing.T) {
+	type row struct {
+		A int `db:"a,omitempty"`
+		B int `db:",omitempty"`
+		C int
+	}
+	fields := structFields(reflect.TypeOf(row{}))
+	got := []string{}
+	for _, f := range fields {
+		got = append(got, f.Name)
+		if f.OmitEmpty != (f.Name != "C") {
+			t.Errorf("the omitempty of %s is %v", f.Name, f.OmitEmpty)
+		}
+	}
+	if !reflect.DeepEqual(got, []string{"a", "B", "C"}) {
+		t.Errorf("got %v", got)
+	}
+	if omitted := omittedParams(&row{A: 1}); !reflect.DeepEqual(omitted, map[string]bool{"B": true}) {
+		t.Errorf("got %v", omitted)
+	}
+	//命名参数使用同一份字段解析
+	if params, err := NamedParams(&row{A: 1, B: 2, C: 3}); err != nil ||
+		!reflect.DeepEqual(params, map[string]interface{}{"a": 1, "B": 2, "C": 3}) {
+		t.Errorf("got %v,%v", params, err)
+	}
+	if &structFields(reflect.TypeOf(row{}))[0] != &fields[0] {
+		t.Error("the fields aren't cached")
+	}
+}
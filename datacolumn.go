@@ -6,9 +6,18 @@ import (
 	"reflect"
 )
 
+//DataColumn is the column of the DataTable,the meaning of Default,Check,Precision,Scale and Computed
+//is same as the TableColumn.NullAsDefault is true then SaveChange omit the column with the Default
+//when insert the row with nil value,so the db use the default value instead of the NULL
 type DataColumn struct {
 	*datatable.DataColumn
-	Desc DBDesc
+	Desc          DBDesc
+	Default       string
+	Check         string
+	Precision     int
+	Scale         int
+	Computed      string
+	NullAsDefault bool
 }
 
 func (d *DataColumn) OriginName() string {
@@ -35,8 +44,29 @@ func (d *DataColumn) PtrValue() interface{} {
 	}
 }
 func (d *DataColumn) Clone() *DataColumn {
-	return &DataColumn{d.DataColumn.Clone(), d.Desc.Clone()}
+	return &DataColumn{d.DataColumn.Clone(), d.Desc.Clone(), d.Default, d.Check, d.Precision, d.Scale, d.Computed, d.NullAsDefault}
 }
 func NewDataColumn(name string, dataType datatable.ColumnType, maxsize int, notnull bool) *DataColumn {
-	return &DataColumn{datatable.NewDataColumn(name, dataType, maxsize, notnull), DBDesc{}}
+	return &DataColumn{datatable.NewDataColumn(name, dataType, maxsize, notnull), DBDesc{}, "", "", 0, 0, "", false}
+}
+
+//the Desc key of the DataColumn,true is the value generated by the db(identity,serial,auto increment,default).
+//it is read from the column define,so isn't saved to the comment of the column and isn't compared by UpdateStruct
+const DescGenerated = "Generated"
+
+//Generated return true if the value is generated by the db,SaveChange omit the column
+//when insert the row with nil value,and write back the generated value to the row
+func (d *DataColumn) Generated() bool {
+	v, _ := d.Desc[DescGenerated].(bool)
+	return v
+}
+func (d *DataColumn) SetGenerated(generated bool) {
+	if d.Desc == nil {
+		d.Desc = DBDesc{}
+	}
+	if generated {
+		d.Desc[DescGenerated] = true
+	} else {
+		delete(d.Desc, DescGenerated)
+	}
 }
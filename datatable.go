@@ -20,6 +20,44 @@ func (i *Index) Equal(value *Index) bool {
 		i.Desc.Equal(value.Desc)
 }
 
+//ForeignKey is the foreign key of the table,the Columns reference the RefColumns of the RefTable.
+//OnDelete and OnUpdate is the action(CASCADE,SET NULL,SET DEFAULT,RESTRICT),empty is NO ACTION
+type ForeignKey struct {
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	OnDelete   string
+	OnUpdate   string
+	Desc       DBDesc
+}
+
+//the action of the foreign key,NO ACTION is empty
+func foreignKeyAction(action string) string {
+	action = strings.ToUpper(strings.TrimSpace(action))
+	if action == "NO ACTION" {
+		return ""
+	}
+	return action
+}
+func (f *ForeignKey) Equal(value *ForeignKey) bool {
+	return reflect.DeepEqual(f.Columns, value.Columns) &&
+		strings.EqualFold(f.RefTable, value.RefTable) &&
+		reflect.DeepEqual(f.RefColumns, value.RefColumns) &&
+		foreignKeyAction(f.OnDelete) == foreignKeyAction(value.OnDelete) &&
+		foreignKeyAction(f.OnUpdate) == foreignKeyAction(value.OnUpdate) &&
+		(f.Desc.IsEmpty() && value.Desc.IsEmpty() || f.Desc.Equal(value.Desc))
+}
+func (f *ForeignKey) Clone() *ForeignKey {
+	return &ForeignKey{
+		Columns:    append([]string{}, f.Columns...),
+		RefTable:   f.RefTable,
+		RefColumns: append([]string{}, f.RefColumns...),
+		OnDelete:   f.OnDelete,
+		OnUpdate:   f.OnUpdate,
+		Desc:       f.Desc.Clone(),
+	}
+}
+
 func (i *Index) Clone() *Index {
 	newColumns := make([]string, len(i.Columns))
 	copy(newColumns, i.Columns)
@@ -32,10 +70,15 @@ func (i *Index) Clone() *Index {
 
 type DataTable struct {
 	*datatable.DataTable
-	Columns   []*DataColumn
-	Indexes   map[string]*Index
-	Desc      DBDesc
-	Temporary bool `json:"-"`
+	Columns     []*DataColumn
+	Indexes     map[string]*Index
+	ForeignKeys map[string]*ForeignKey
+	Desc        DBDesc
+	Temporary   bool `json:"-"`
+	//the options of the SaveChange,not saved to the db
+	versionColumn     string
+	pkOnly            bool
+	updateChangedOnly bool
 }
 
 func NewDataTable(name string) *DataTable {
@@ -43,8 +86,12 @@ func NewDataTable(name string) *DataTable {
 		datatable.NewDataTable(name),
 		nil,
 		map[string]*Index{},
+		map[string]*ForeignKey{},
 		DBDesc{},
 		false,
+		"",
+		false,
+		false,
 	}
 }
 func (d *DataTable) Clone() *DataTable {
@@ -56,12 +103,20 @@ func (d *DataTable) Clone() *DataTable {
 	for i, v := range d.Indexes {
 		indexes[i] = v.Clone()
 	}
+	fks := map[string]*ForeignKey{}
+	for i, v := range d.ForeignKeys {
+		fks[i] = v.Clone()
+	}
 	return &DataTable{
 		d.DataTable.Clone(),
 		cols,
 		indexes,
+		fks,
 		d.Desc.Clone(),
 		d.Temporary,
+		d.versionColumn,
+		d.pkOnly,
+		d.updateChangedOnly,
 	}
 }
 
@@ -78,6 +133,13 @@ func (d *DataTable) AddIndex(indexName string, index *Index) {
 	d.Indexes[indexName] = index
 }
 
+func (d *DataTable) AddForeignKey(name string, fk *ForeignKey) {
+	if d.ForeignKeys == nil {
+		d.ForeignKeys = map[string]*ForeignKey{}
+	}
+	d.ForeignKeys[name] = fk
+}
+
 func (d *DataTable) AddColumn(col *DataColumn) *DataColumn {
 
 	d.DataTable.AddColumn(col.DataColumn)
@@ -101,3 +163,31 @@ func (t *DataTable) SelectAllByID() string {
 	}
 	return t.SelectAllByWhere(strings.Join(where, " AND\n\t"))
 }
+
+//VersionColumn return the row version column declared by SetVersionColumn,empty if not declared
+func (t *DataTable) VersionColumn() string {
+	return t.versionColumn
+}
+
+//SetVersionColumn declare the row version column,SaveChange update and delete the row by the primary key
+//and the version,and change the version of the updated row(integer +1,time is now).empty name remove it
+func (t *DataTable) SetVersionColumn(name string) {
+	t.versionColumn = name
+}
+
+//PKOnly return true if SaveChange update the row only by the primary key(no version column),
+//otherwise all the columns are compared with the origin values
+func (t *DataTable) PKOnly() bool {
+	return t.pkOnly
+}
+func (t *DataTable) UpdateChangedOnly() bool {
+	return t.updateChangedOnly
+}
+
+//SetUpdateChangedOnly let SaveChange update only the changed columns of the row
+func (t *DataTable) SetUpdateChangedOnly(changedOnly bool) {
+	t.updateChangedOnly = changedOnly
+}
+func (t *DataTable) SetPKOnly(pkOnly bool) {
+	t.pkOnly = pkOnly
+}
@@ -7,23 +7,31 @@ import (
 
 type DBDesc map[string]interface{}
 
-func copyMap(src map[string]interface{}) map[string]interface{} {
+func copyMap(src map[string]interface{}) (map[string]interface{}, error) {
 	buf, err := json.Marshal(src)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	rev := map[string]interface{}{}
 	err = json.Unmarshal(buf, &rev)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return rev
+	return rev, nil
 }
 func (p DBDesc) IsEmpty() bool {
 	return len(p) == 0
 }
+//Clone return a deep copy through json,if some value can't be marshaled,return a shallow copy
 func (p DBDesc) Clone() DBDesc {
-	return copyMap(p)
+	rev, err := copyMap(p)
+	if err != nil {
+		rev = map[string]interface{}{}
+		for k, v := range p {
+			rev[k] = v
+		}
+	}
+	return rev
 }
 func (p DBDesc) Equal(p1 DBDesc) bool {
 	if len(p) != len(p1) {
@@ -38,12 +46,9 @@ func (p DBDesc) String() string {
 	}
 	return string(buf)
 }
-func (p DBDesc) Parse(str string) {
+func (p DBDesc) Parse(str string) error {
 	if str == "" {
-		return
-	}
-	err := json.Unmarshal([]byte(str), &p)
-	if err != nil {
-		panic(err)
+		return nil
 	}
+	return json.Unmarshal([]byte(str), &p)
 }
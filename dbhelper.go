@@ -2,179 +2,348 @@ package dbhelper
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
-	"reflect"
 	"regexp"
 	"strings"
-	"text/template"
 )
 
 var (
 	driverMetahelpers map[string]MetaHelper = map[string]MetaHelper{}
+	//内置的metahelper,允许被用户注册的同名metahelper覆盖
+	builtinMetahelpers map[string]bool = map[string]bool{}
 )
 
+//DBHelper returned by NewDBHelper is a wrapper of the connection pool,it's safe for concurrent use.
+//the DBHelper returned by Begin is bind to the transaction,should be used by one goroutine
 type DBHelper struct {
 	driverName     string
 	dataSourceName string
 	metaHelper     MetaHelper
 	db             *sql.DB
 	tx             *sql.Tx
+	//the savepoint of the nested transaction,empty is the outermost
+	savepoint string
+	//the nested level of the transaction
+	level     int
+	ctx       context.Context
+	templates *templateCache
+	//the table struct cache of the Insert,Update,Upsert and Delete
+	tables      *tableCache
+	options     Options
+	saveOptions SaveOptions
+	hooks       []QueryHook
 }
 type ParamPlaceholder func(strSql string, num int) string
 
+//RegisterMetaHelper register the MetaHelper of the driver,the meta must implement the MetaBinder
 func RegisterMetaHelper(driverName string, meta MetaHelper) {
-	if _, ok := driverMetahelpers[driverName]; ok {
+	if _, ok := meta.(MetaBinder); !ok {
+		panic(fmt.Errorf("the driver %q meta %T not implement the MetaBinder", driverName, meta))
+	}
+	if _, ok := driverMetahelpers[driverName]; ok && !builtinMetahelpers[driverName] {
 		panic(fmt.Errorf("the driver %q meta has exists", driverName))
 	}
+	delete(builtinMetahelpers, driverName)
 	driverMetahelpers[driverName] = meta
 }
-func NewDBHelper(driverName, dataSourceName string) *DBHelper {
+func registerBuiltinMetaHelper(driverName string, meta MetaHelper) {
+	RegisterMetaHelper(driverName, meta)
+	builtinMetahelpers[driverName] = true
+}
+//NewDBHelper create the DBHelper of the driver,the opts(only the first is used) is applied when Open
+func NewDBHelper(driverName, dataSourceName string, opts ...*Options) *DBHelper {
 	meta, ok := driverMetahelpers[driverName]
 	if !ok {
 		panic(fmt.Errorf("the driver %q's metahelper not found", driverName))
 	}
-	rev := &DBHelper{driverName, dataSourceName, meta, nil, nil}
-	meta.SetDBHelper(rev)
+	rev := &DBHelper{
+		driverName:     driverName,
+		dataSourceName: dataSourceName,
+		templates:      newTemplateCache(DefaultTemplateCacheSize),
+		tables:         newTableCache(),
+	}
+	if len(opts) > 0 && opts[0] != nil {
+		rev.options = *opts[0]
+	}
+	rev.metaHelper = meta.(MetaBinder).Bind(rev)
 	return rev
 }
-func (h *DBHelper) ConvertSql(sql string, args map[string]interface{}) string {
-	phCount := 0
-	t := template.New("sql").Funcs(template.FuncMap{
-		"ph": func() string {
-			phCount++
-			return h.metaHelper.ParamPlaceholder(phCount)
-		},
-		"str": func(v string) string {
-			return h.metaHelper.StringExpress(v)
-		},
-		"reglike": func(value, strRegexp string) string {
-			return h.metaHelper.RegLike(value, strRegexp)
-		},
-		"strcat": func(values ...string) string {
-			return h.metaHelper.StringCat(values...)
-		},
-	})
-	t, err := t.Parse(sql)
+
+//WithContext return a DBHelper that share the connection and the transaction with h,
+//all the method without context(include the MetaHelper operations) use the ctx
+func (h *DBHelper) WithContext(ctx context.Context) *DBHelper {
+	if ctx == nil {
+		panic(fmt.Errorf("nil context"))
+	}
+	rev := h.clone()
+	rev.ctx = ctx
+	return rev
+}
+
+//a copy of h,bind a copy of the MetaHelper
+func (h *DBHelper) clone() *DBHelper {
+	rev := *h
+	rev.metaHelper = h.metaHelper.(MetaBinder).Bind(&rev)
+	return &rev
+}
+func (h *DBHelper) context() context.Context {
+	if h.ctx != nil {
+		return h.ctx
+	}
+	return context.Background()
+}
+
+//ConvertSql execute the sql template,return the sql of the driver.
+//the error is a *TemplateError when the template parse or execute fail.
+//the sql use the named param must be converted by ConvertSqlArgs
+func (h *DBHelper) ConvertSql(sql string, args map[string]interface{}) (string, error) {
+	rev, state, err := h.executeTemplate(sql, args, nil)
 	if err != nil {
-		strErr := ""
-		for i, v := range strings.Split(sql, "\n") {
-			strErr += fmt.Sprintf("%d\t%s\n", i+1, v)
-		}
-		panic(fmt.Errorf("%s\n%s", err, strErr))
+		return "", err
 	}
+	if state.named {
+		return "", NewTemplateError(sql, fmt.Errorf("the sql use the named param,the args will be lost,use ConvertSqlArgs"))
+	}
+	return rev, nil
+}
+
+//ConvertSqlArgs execute the sql template,return the sql of the driver and the args.
+//if the template use {{param "name"}},the args is rebuild in the order of the placeholder,
+//{{ph}} take the next value of the args and {{param "name"}} take templateParam["name"]
+func (h *DBHelper) ConvertSqlArgs(sql string, templateParam map[string]interface{}, args ...interface{}) (string, []interface{}, error) {
+	rev, state, err := h.executeTemplate(sql, templateParam, args)
+	if err != nil {
+		return "", nil, err
+	}
+	return rev, state.result(), nil
+}
+func (h *DBHelper) executeTemplate(sql string, templateParam map[string]interface{}, args []interface{}) (string, *templateState, error) {
+	t, err := h.templates.get(sql, h.parseTemplate)
+	if err != nil {
+		return "", nil, NewTemplateError(sql, err)
+	}
+	//缓存的模板是共享的,需要复制后绑定本次执行的函数
+	if t, err = t.Clone(); err != nil {
+		return "", nil, NewTemplateError(sql, err)
+	}
+	state := &templateState{params: templateParam, args: args}
+	t.Funcs(h.templateFuncs(state))
 	param := map[string]interface{}{}
-	for i, v := range args {
+	for i, v := range templateParam {
 		param[i] = v
 	}
 	param["DriverName"] = h.driverName
 	buf := &bytes.Buffer{}
 	err = t.Execute(buf, param)
+	if err != nil {
+		return "", nil, NewTemplateError(sql, err)
+	}
+	return buf.String(), state, nil
+}
+
+//MustConvertSql is like ConvertSql but panics if the template can't be parsed or executed
+func (h *DBHelper) MustConvertSql(sql string, args map[string]interface{}) string {
+	rev, err := h.ConvertSql(sql, args)
 	if err != nil {
 		panic(err)
 	}
-	return buf.String()
+	return rev
 }
+//Open open the db and set the pool by the Options,ping the db if Options.Ping is set
 func (h *DBHelper) Open() error {
 	if h.db != nil {
-		return fmt.Errorf("already open")
+		return ErrAlreadyOpen
 	}
 	db, err := sql.Open(h.driverName, h.dataSourceName)
 	if err != nil {
 		return err
 	}
+	h.options.apply(db)
+	if h.options.Ping {
+		if err = h.options.ping(h.context(), db); err != nil {
+			db.Close()
+			return err
+		}
+	}
 	h.db = db
 	return nil
 }
 func (h *DBHelper) Close() error {
+	if h.tx != nil {
+		return fmt.Errorf("the DBHelper of the trans can't be closed,commit or rollback it")
+	}
 	if h.db == nil {
-		return fmt.Errorf("the db not open")
+		return ErrNotOpen
 	}
 	err := h.db.Close()
 	if err != nil {
 		return err
 	}
 	h.db = nil
-	h.tx = nil
 	return nil
 }
-func (h *DBHelper) Begin() error {
+func (h *DBHelper) Begin() (*DBHelper, error) {
+	return h.BeginTx(h.context(), nil)
+}
 
+//BeginTx start a transaction and return the DBHelper bind to it,the query and the exec of
+//the returned DBHelper run in the transaction,and h isn't changed.
+//the transaction will be rollback if the ctx is done before commit.
+//if h is bind to a transaction and the MetaHelper is a SavepointBuilder,a savepoint is created,
+//the Commit release it and the Rollback roll back to it
+func (h *DBHelper) BeginTx(ctx context.Context, opts *sql.TxOptions) (*DBHelper, error) {
 	if h.tx != nil {
-		return fmt.Errorf("already begin trans")
+		sp, ok := h.metaHelper.(SavepointBuilder)
+		if !ok {
+			return nil, fmt.Errorf("%w,the %s not support the savepoint", ErrTxAlreadyBegun, h.driverName)
+		}
+		if opts != nil {
+			return nil, fmt.Errorf("the nested trans can't set the TxOptions")
+		}
+		name := fmt.Sprintf("dbhelper_sp%d", h.level+1)
+		if err := h.execTx(ctx, sp.SavepointSql(name)); err != nil {
+			return nil, err
+		}
+		return h.txHelper(h.tx, name, h.level+1), nil
 	}
 	if h.db == nil {
-		return fmt.Errorf("db not open")
+		return nil, ErrNotOpen
 	}
-	tx, err := h.db.Begin()
+	tx, err := h.db.BeginTx(ctx, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	h.tx = tx
-	return nil
+	return h.txHelper(tx, "", 0), nil
+}
+func (h *DBHelper) txHelper(tx *sql.Tx, savepoint string, level int) *DBHelper {
+	rev := h.clone()
+	rev.tx = tx
+	rev.savepoint = savepoint
+	rev.level = level
+	return rev
+}
+
+//the Begin can be called,not in a transaction or the savepoint is supported
+func (h *DBHelper) canBegin() bool {
+	if h.tx == nil {
+		return true
+	}
+	_, ok := h.metaHelper.(SavepointBuilder)
+	return ok
 }
 func (h *DBHelper) Commit() error {
 	if h.tx == nil {
-		return fmt.Errorf("the trans not begin")
+		return ErrTxNotBegun
 	}
-	err := h.tx.Commit()
-	if err != nil {
-		return err
+	if h.savepoint != "" {
+		return h.execTx(h.context(), h.metaHelper.(SavepointBuilder).ReleaseSavepointSql(h.savepoint))
 	}
-	h.tx = nil
-
-	return nil
+	return h.tx.Commit()
 }
 func (h *DBHelper) Rollback() error {
-
 	if h.tx == nil {
-		return fmt.Errorf("the trans not begin")
+		return ErrTxNotBegun
+	}
+	if h.savepoint != "" {
+		sp := h.metaHelper.(SavepointBuilder)
+		//回滚后savepoint仍然存在,需要释放
+		if err := h.execTx(h.context(), sp.RollbackToSavepointSql(h.savepoint)); err != nil {
+			return err
+		}
+		return h.execTx(h.context(), sp.ReleaseSavepointSql(h.savepoint))
 	}
-	err := h.tx.Rollback()
+	return h.tx.Rollback()
+}
+
+//exec the sql(not template) in the transaction
+func (h *DBHelper) execTx(ctx context.Context, strSql string) error {
+	return h.trace(ctx, "exec", strSql, nil, func(ctx context.Context) (int64, error) {
+		return rowsAffected(h.tx.ExecContext(ctx, strSql))
+	})
+}
+func rowsAffected(result sql.Result, err error) (int64, error) {
 	if err != nil {
-		return err
+		return -1, err
 	}
-	h.tx = nil
-	return nil
+	if n, err := result.RowsAffected(); err == nil {
+		return n, nil
+	}
+	return -1, nil
 }
 func (h *DBHelper) Query(query string, args ...interface{}) (rows *sql.Rows, err error) {
-	return h.QueryT(query, nil, args...)
+	return h.QueryTContext(h.context(), query, nil, args...)
+}
+func (h *DBHelper) QueryContext(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	return h.QueryTContext(ctx, query, nil, args...)
 }
 func (h *DBHelper) QueryT(query string, templateParam map[string]interface{}, args ...interface{}) (rows *sql.Rows, err error) {
+	return h.QueryTContext(h.context(), query, templateParam, args...)
+}
+func (h *DBHelper) QueryTContext(ctx context.Context, query string, templateParam map[string]interface{}, args ...interface{}) (rows *sql.Rows, err error) {
 	if h.db == nil {
-		return nil, fmt.Errorf("db not open")
+		return nil, ErrNotOpen
 	}
-	strSql := h.ConvertSql(query, templateParam)
-
-	if h.tx != nil {
-		rows, err = h.tx.Query(strSql, args...)
-	} else {
-		rows, err = h.db.Query(strSql, args...)
+	strSql, args, err := h.ConvertSqlArgs(query, templateParam, args...)
+	if err != nil {
+		return nil, err
 	}
+	err = h.trace(ctx, "query", strSql, args, func(ctx context.Context) (int64, error) {
+		var err error
+		if h.tx != nil {
+			rows, err = h.tx.QueryContext(ctx, strSql, args...)
+		} else {
+			rows, err = h.db.QueryContext(ctx, strSql, args...)
+		}
+		return -1, err
+	})
 	if err != nil {
-		err = NewSqlError(strSql, err, args...)
+		err = h.sqlError(strSql, err, args...)
 	}
 	return
 }
-func (h *DBHelper) QueryRow(query string, args ...interface{}) *sql.Row {
-	return h.QueryRowT(query, nil, args...)
+func (h *DBHelper) QueryRow(query string, args ...interface{}) *Row {
+	return h.QueryRowTContext(h.context(), query, nil, args...)
+}
+func (h *DBHelper) QueryRowContext(ctx context.Context, query string, args ...interface{}) *Row {
+	return h.QueryRowTContext(ctx, query, nil, args...)
+}
+func (h *DBHelper) QueryRowT(query string, templateParam map[string]interface{}, args ...interface{}) *Row {
+	return h.QueryRowTContext(h.context(), query, templateParam, args...)
 }
-func (h *DBHelper) QueryRowT(query string, templateParam map[string]interface{}, args ...interface{}) *sql.Row {
+
+//QueryRowTContext never return nil,the error of the template or the db not open is deferred until Row's Scan method is called
+func (h *DBHelper) QueryRowTContext(ctx context.Context, query string, templateParam map[string]interface{}, args ...interface{}) *Row {
 	if h.db == nil {
-		panic(fmt.Errorf("db not open"))
+		return &Row{err: ErrNotOpen}
 	}
-	strSql := h.ConvertSql(query, templateParam)
-	if h.tx != nil {
-		return h.tx.QueryRow(strSql, args...)
-	} else {
-		return h.db.QueryRow(strSql, args...)
+	strSql, args, err := h.ConvertSqlArgs(query, templateParam, args...)
+	if err != nil {
+		return &Row{err: err}
 	}
+	var row *sql.Row
+	h.trace(ctx, "queryrow", strSql, args, func(ctx context.Context) (int64, error) {
+		if h.tx != nil {
+			row = h.tx.QueryRowContext(ctx, strSql, args...)
+		} else {
+			row = h.db.QueryRowContext(ctx, strSql, args...)
+		}
+		return -1, row.Err()
+	})
+	return &Row{row: row, h: h, strSql: strSql, args: args}
 }
 func (h *DBHelper) Exists(Query string, args ...interface{}) (bool, error) {
-	return h.ExistsT(Query, nil, args...)
+	return h.ExistsTContext(h.context(), Query, nil, args...)
+}
+func (h *DBHelper) ExistsContext(ctx context.Context, Query string, args ...interface{}) (bool, error) {
+	return h.ExistsTContext(ctx, Query, nil, args...)
 }
 func (h *DBHelper) ExistsT(Query string, templateParam map[string]interface{}, args ...interface{}) (bool, error) {
-	if rows, err := h.QueryT(Query, templateParam, args...); err != nil {
+	return h.ExistsTContext(h.context(), Query, templateParam, args...)
+}
+func (h *DBHelper) ExistsTContext(ctx context.Context, Query string, templateParam map[string]interface{}, args ...interface{}) (bool, error) {
+	if rows, err := h.QueryTContext(ctx, Query, templateParam, args...); err != nil {
 		return false, err
 	} else {
 		defer rows.Close()
@@ -202,15 +371,25 @@ func decodeQuery(query string) []string {
 	return rev
 }
 func (h *DBHelper) GoGetData(query string) (*DataTable, error) {
-	return h.GoGetDataT(query, nil)
+	return h.GoGetDataTContext(h.context(), query, nil)
+}
+func (h *DBHelper) GoGetDataContext(ctx context.Context, query string) (*DataTable, error) {
+	return h.GoGetDataTContext(ctx, query, nil)
 }
 func (h *DBHelper) GoGetDataT(query string, templateParam map[string]interface{}) (*DataTable, error) {
-	sqls := decodeQuery(h.ConvertSql(query, templateParam))
+	return h.GoGetDataTContext(h.context(), query, templateParam)
+}
+func (h *DBHelper) GoGetDataTContext(ctx context.Context, query string, templateParam map[string]interface{}) (*DataTable, error) {
+	strSql, err := h.ConvertSql(query, templateParam)
+	if err != nil {
+		return nil, err
+	}
+	sqls := decodeQuery(strSql)
 	for i, v := range sqls {
 		if i == len(sqls)-1 {
-			return h.GetData(v, nil)
+			return h.GetDataContext(ctx, v)
 		} else {
-			if _, err := h.Exec(v, nil); err != nil {
+			if _, err := h.ExecContext(ctx, v); err != nil {
 				return nil, err
 			}
 		}
@@ -218,12 +397,22 @@ func (h *DBHelper) GoGetDataT(query string, templateParam map[string]interface{}
 	return nil, fmt.Errorf("can't run this")
 }
 func (h *DBHelper) GoExec(query string) error {
-	return h.GoExecT(query, nil)
+	return h.GoExecTContext(h.context(), query, nil)
+}
+func (h *DBHelper) GoExecContext(ctx context.Context, query string) error {
+	return h.GoExecTContext(ctx, query, nil)
 }
 func (h *DBHelper) GoExecT(query string, templateParam map[string]interface{}) error {
-	sqls := decodeQuery(h.ConvertSql(query, templateParam))
+	return h.GoExecTContext(h.context(), query, templateParam)
+}
+func (h *DBHelper) GoExecTContext(ctx context.Context, query string, templateParam map[string]interface{}) error {
+	strSql, err := h.ConvertSql(query, templateParam)
+	if err != nil {
+		return err
+	}
+	sqls := decodeQuery(strSql)
 	for _, v := range sqls {
-		if _, err := h.Exec(v); err != nil {
+		if _, err := h.ExecContext(ctx, v); err != nil {
 			return err
 		}
 	}
@@ -232,67 +421,122 @@ func (h *DBHelper) GoExecT(query string, templateParam map[string]interface{}) e
 }
 
 func (h *DBHelper) QueryOne(query string, args ...interface{}) (interface{}, error) {
-	return h.QueryOneT(query, nil, args...)
+	return h.QueryOneTContext(h.context(), query, nil, args...)
+}
+func (h *DBHelper) QueryOneContext(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	return h.QueryOneTContext(ctx, query, nil, args...)
 }
 func (h *DBHelper) QueryOneT(query string, templateParam map[string]interface{}, args ...interface{}) (interface{}, error) {
+	return h.QueryOneTContext(h.context(), query, templateParam, args...)
+}
+func (h *DBHelper) QueryOneTContext(ctx context.Context, query string, templateParam map[string]interface{}, args ...interface{}) (interface{}, error) {
+	if h.db == nil {
+		return nil, ErrNotOpen
+	}
 	var row *sql.Row
-	strSql := h.ConvertSql(query, templateParam)
-	if h.tx != nil {
-		row = h.tx.QueryRow(strSql, args...)
-	} else {
-		row = h.db.QueryRow(strSql, args...)
+	strSql, args, err := h.ConvertSqlArgs(query, templateParam, args...)
+	if err != nil {
+		return nil, err
 	}
 	var rev interface{}
-	err := row.Scan(&rev)
+	h.trace(ctx, "queryrow", strSql, args, func(ctx context.Context) (int64, error) {
+		if h.tx != nil {
+			row = h.tx.QueryRowContext(ctx, strSql, args...)
+		} else {
+			row = h.db.QueryRowContext(ctx, strSql, args...)
+		}
+		//没有记录不算错误
+		if err = row.Scan(&rev); err == sql.ErrNoRows {
+			return -1, nil
+		}
+		return -1, err
+	})
 	if sql.ErrNoRows == err {
 		return nil, nil
 	}
 	if err != nil {
-		err = NewSqlError(strSql, err, args...)
+		err = h.sqlError(strSql, err, args...)
 	}
 	return rev, err
 }
 func (h *DBHelper) Exec(query string, args ...interface{}) (result sql.Result, err error) {
-	return h.ExecT(query, nil, args...)
+	return h.ExecTContext(h.context(), query, nil, args...)
+}
+func (h *DBHelper) ExecContext(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
+	return h.ExecTContext(ctx, query, nil, args...)
 }
 func (h *DBHelper) ExecT(query string, templateParam map[string]interface{}, args ...interface{}) (result sql.Result, err error) {
+	return h.ExecTContext(h.context(), query, templateParam, args...)
+}
+func (h *DBHelper) ExecTContext(ctx context.Context, query string, templateParam map[string]interface{}, args ...interface{}) (result sql.Result, err error) {
 	if h.db == nil {
-		return nil, fmt.Errorf("db not open")
+		return nil, ErrNotOpen
 	}
-	strSql := h.ConvertSql(query, templateParam)
-	if h.tx != nil {
-		result, err = h.tx.Exec(strSql, args...)
-	} else {
-		result, err = h.db.Exec(strSql, args...)
+	strSql, args, err := h.ConvertSqlArgs(query, templateParam, args...)
+	if err != nil {
+		return nil, err
 	}
+	return h.execSql(ctx, strSql, args)
+}
+
+//execute the converted sql
+func (h *DBHelper) execSql(ctx context.Context, strSql string, args []interface{}) (result sql.Result, err error) {
+	err = h.trace(ctx, "exec", strSql, args, func(ctx context.Context) (int64, error) {
+		var err error
+		if h.tx != nil {
+			result, err = h.tx.ExecContext(ctx, strSql, args...)
+		} else {
+			result, err = h.db.ExecContext(ctx, strSql, args...)
+		}
+		return rowsAffected(result, err)
+	})
 	if err != nil {
-		err = NewSqlError(strSql, err, args...)
+		err = h.sqlError(strSql, err, args...)
 	}
 	return
 }
 func (h *DBHelper) Prepare(query string) (stmt *sql.Stmt, err error) {
-	return h.PrepareT(query, nil)
+	return h.PrepareTContext(h.context(), query, nil)
+}
+func (h *DBHelper) PrepareContext(ctx context.Context, query string) (stmt *sql.Stmt, err error) {
+	return h.PrepareTContext(ctx, query, nil)
 }
 func (h *DBHelper) PrepareT(query string, templateParam map[string]interface{}) (stmt *sql.Stmt, err error) {
+	return h.PrepareTContext(h.context(), query, templateParam)
+}
+func (h *DBHelper) PrepareTContext(ctx context.Context, query string, templateParam map[string]interface{}) (stmt *sql.Stmt, err error) {
 	if h.db == nil {
-		return nil, fmt.Errorf("db not open")
+		return nil, ErrNotOpen
 	}
-	strSql := h.ConvertSql(query, templateParam)
-	if h.tx != nil {
-		stmt, err = h.tx.Prepare(strSql)
-	} else {
-		stmt, err = h.db.Prepare(strSql)
+	strSql, err := h.ConvertSql(query, templateParam)
+	if err != nil {
+		return nil, err
 	}
+	err = h.trace(ctx, "prepare", strSql, nil, func(ctx context.Context) (int64, error) {
+		var err error
+		if h.tx != nil {
+			stmt, err = h.tx.PrepareContext(ctx, strSql)
+		} else {
+			stmt, err = h.db.PrepareContext(ctx, strSql)
+		}
+		return -1, err
+	})
 	if err != nil {
-		err = NewSqlError(strSql, err, nil)
+		err = h.sqlError(strSql, err)
 	}
 	return
 }
 func (h *DBHelper) FillTable(table *DataTable, query string, args ...interface{}) error {
-	return h.FillTableT(table, query, nil, args...)
+	return h.FillTableTContext(h.context(), table, query, nil, args...)
+}
+func (h *DBHelper) FillTableContext(ctx context.Context, table *DataTable, query string, args ...interface{}) error {
+	return h.FillTableTContext(ctx, table, query, nil, args...)
 }
 func (h *DBHelper) FillTableT(table *DataTable, query string, templateParam map[string]interface{}, args ...interface{}) error {
-	rows, err := h.QueryT(query, templateParam, args...)
+	return h.FillTableTContext(h.context(), table, query, templateParam, args...)
+}
+func (h *DBHelper) FillTableTContext(ctx context.Context, table *DataTable, query string, templateParam map[string]interface{}, args ...interface{}) error {
+	rows, err := h.QueryTContext(ctx, query, templateParam, args...)
 	if err != nil {
 		return err
 	}
@@ -300,31 +544,51 @@ func (h *DBHelper) FillTableT(table *DataTable, query string, templateParam map[
 	return err
 }
 func (h *DBHelper) StepTable(table *DataTable, step int64, query string, args ...interface{}) (*StepTable, error) {
-	return h.StepTableT(table, step, query, nil, args...)
+	return h.StepTableTContext(h.context(), table, step, query, nil, args...)
+}
+func (h *DBHelper) StepTableContext(ctx context.Context, table *DataTable, step int64, query string, args ...interface{}) (*StepTable, error) {
+	return h.StepTableTContext(ctx, table, step, query, nil, args...)
 }
 func (h *DBHelper) StepTableT(table *DataTable, step int64, query string, templateParam map[string]interface{}, args ...interface{}) (*StepTable, error) {
-	rows, err := h.QueryT(query, templateParam, args...)
+	return h.StepTableTContext(h.context(), table, step, query, templateParam, args...)
+}
+
+//StepTableTContext return a StepTable,the ctx must be valid until the StepTable closed
+func (h *DBHelper) StepTableTContext(ctx context.Context, table *DataTable, step int64, query string, templateParam map[string]interface{}, args ...interface{}) (*StepTable, error) {
+	rows, err := h.QueryTContext(ctx, query, templateParam, args...)
 	if err != nil {
 		return nil, err
 	}
 	return &StepTable{rows, table, step}, nil
 }
 func (h *DBHelper) GetData(query string, args ...interface{}) (*DataTable, error) {
-	return h.GetDataT(query, nil, args...)
+	return h.GetDataTContext(h.context(), query, nil, args...)
+}
+func (h *DBHelper) GetDataContext(ctx context.Context, query string, args ...interface{}) (*DataTable, error) {
+	return h.GetDataTContext(ctx, query, nil, args...)
 }
 func (h *DBHelper) SelectLimit(srcSql string, pkFields []string, startKeyValue map[string]interface{}, selectCols []string, where string, orderby []string, limit int) (*DataTable, error) {
-	sql, vals := h.metaHelper.BuildSelectLimitSql(srcSql, pkFields, startKeyValue, selectCols, where, orderby, limit)
-	return h.GetData(sql, vals...)
+	return h.SelectLimitTContext(h.context(), srcSql, nil, pkFields, startKeyValue, selectCols, where, orderby, limit)
+}
+func (h *DBHelper) SelectLimitContext(ctx context.Context, srcSql string, pkFields []string, startKeyValue map[string]interface{}, selectCols []string, where string, orderby []string, limit int) (*DataTable, error) {
+	return h.SelectLimitTContext(ctx, srcSql, nil, pkFields, startKeyValue, selectCols, where, orderby, limit)
 }
 func (h *DBHelper) SelectLimitT(srcSql string, templateParam map[string]interface{}, pkFields []string, startKeyValue map[string]interface{}, selectCols []string, where string, orderby []string, limit int) (*DataTable, error) {
+	return h.SelectLimitTContext(h.context(), srcSql, templateParam, pkFields, startKeyValue, selectCols, where, orderby, limit)
+}
+func (h *DBHelper) SelectLimitTContext(ctx context.Context, srcSql string, templateParam map[string]interface{}, pkFields []string, startKeyValue map[string]interface{}, selectCols []string, where string, orderby []string, limit int) (*DataTable, error) {
 	sql, vals := h.metaHelper.BuildSelectLimitSql(srcSql, pkFields, startKeyValue, selectCols, where, orderby, limit)
-	return h.GetDataT(sql, templateParam, vals...)
+	return h.GetDataTContext(ctx, sql, templateParam, vals...)
 }
 func (h *DBHelper) BuildSelectLimitSql(srcSql string, pkFields []string, startKeyValue map[string]interface{}, selectCols []string, where string, orderby []string, limit int) (string, []interface{}) {
 	return h.metaHelper.BuildSelectLimitSql(srcSql, pkFields, startKeyValue, selectCols, where, orderby, limit)
 }
 func (h *DBHelper) GetDataT(query string, templateParam map[string]interface{}, args ...interface{}) (*DataTable, error) {
-	rows, err := h.QueryT(query, templateParam, args...)
+	return h.GetDataTContext(h.context(), query, templateParam, args...)
+}
+func (h *DBHelper) GetDataTContext(ctx context.Context, query string, templateParam map[string]interface{}, args ...interface{}) (*DataTable, error) {
+	rows, err := h.QueryTContext(ctx, query, templateParam, args...)
+
 	if err != nil {
 		return nil, err
 	}
@@ -361,11 +625,18 @@ func (h *DBHelper) GetDataT(query string, templateParam map[string]interface{},
 	return result, err
 }
 func (h *DBHelper) DropTable(tablename string) error {
+	defer h.InvalidateTable(tablename)
 	return h.metaHelper.DropTable(tablename)
 }
+func (h *DBHelper) DropTableContext(ctx context.Context, tablename string) error {
+	return h.WithContext(ctx).DropTable(tablename)
+}
 func (h *DBHelper) TableExists(tablename string) (bool, error) {
 	return h.metaHelper.TableExists(tablename)
 }
+func (h *DBHelper) TableExistsContext(ctx context.Context, tablename string) (bool, error) {
+	return h.WithContext(ctx).TableExists(tablename)
+}
 func getOrderColumns(columns []*TableColumn, order []string) []*TableColumn {
 	cleanOrder := order
 	//插入未标明的字段
@@ -393,6 +664,9 @@ func getOrderColumns(columns []*TableColumn, order []string) []*TableColumn {
 	}
 	return rev
 }
+func (h *DBHelper) TableContext(ctx context.Context, tablename string) (*DataTable, error) {
+	return h.WithContext(ctx).Table(tablename)
+}
 func (h *DBHelper) Table(tablename string) (*DataTable, error) {
 	result := NewDataTable(tablename)
 	var err error
@@ -426,6 +700,11 @@ func (h *DBHelper) Table(tablename string) (*DataTable, error) {
 	for _, col := range columns {
 		aColumn := NewDataColumn(col.Name, col.Type, col.MaxSize, col.NotNull)
 		aColumn.Desc = col.Desc
+		aColumn.Default = col.Default
+		aColumn.Check = col.Check
+		aColumn.Precision = col.Precision
+		aColumn.Scale = col.Scale
+		aColumn.Computed = col.Computed
 		result.AddColumn(aColumn)
 	}
 	//获取主键
@@ -444,15 +723,22 @@ func (h *DBHelper) Table(tablename string) (*DataTable, error) {
 	for _, oneIndex := range tIndexes {
 		result.AddIndex(oneIndex.Name, &Index{oneIndex.Columns, oneIndex.Unique, oneIndex.Desc})
 	}
+	//获取外键
+	tFks, err := h.metaHelper.GetForeignKeys(tablename)
+	if err != nil {
+		return nil, err
+	}
+	for _, fk := range tFks {
+		result.AddForeignKey(fk.Name, &ForeignKey{fk.Columns, fk.RefTable, fk.RefColumns, fk.OnDelete, fk.OnUpdate, fk.Desc})
+	}
 
 	return result, nil
 }
 func (h *DBHelper) SaveChange(table *DataTable) (rcount int64, err error) {
-
-	if h.tx == nil {
-		if err = h.Begin(); err != nil {
-			return
-		}
+	return h.SaveChangeContext(h.context(), table)
+}
+func (h *DBHelper) SaveChangeContext(ctx context.Context, table *DataTable) (rcount int64, err error) {
+	err = h.InTxContext(ctx, func(th *DBHelper) (err error) {
 		defer func() {
 			if p := recover(); p != nil {
 				switch p := p.(type) {
@@ -462,168 +748,28 @@ func (h *DBHelper) SaveChange(table *DataTable) (rcount int64, err error) {
 					err = fmt.Errorf("%s", p)
 				}
 			}
-			if err != nil {
-				h.tx.Rollback()
-				return
-			}
-			err = h.tx.Commit()
-			if err == nil {
-				h.tx = nil
-			}
 		}()
-	}
-	rcount, err = internalUpdateTableTx(h.tx, table, h.ConvertSql)
+		rcount, err = internalUpdateTableTx(ctx, th, table)
+		return
+	}, nil)
 	return
 }
-func (p *DBHelper) UpdateStruct(oldStruct, newStruct *DataTable, oldColumnsOrder []string) error {
-	colOrders := &columnOrder{oldColumnsOrder}
-	if len(newStruct.TableName) == 0 {
-		return fmt.Errorf("the table name is empty")
-	}
-	tablename := newStruct.TableName
-	if oldStruct == nil {
-		newStruct.Desc["ColumnsOrder"] = oldColumnsOrder
-		return p.metaHelper.CreateTable(newStruct)
-	}
-
-	//首先判断主关键字是否有变化
-	bKeyChange := false
-	if !reflect.DeepEqual(oldStruct.PK, newStruct.PK) {
-		bKeyChange = true
-	}
-	if !bKeyChange {
-		//判断主键的数据类型是否变化
-		oldPks := oldStruct.PK
-		newPks := newStruct.PK
-		for i := 0; i < len(oldPks); i++ {
-			if oldStruct.Columns[oldStruct.ColumnIndex(oldPks[i])].DataType !=
-				newStruct.Columns[newStruct.ColumnIndex(newPks[i])].DataType ||
-				oldStruct.Columns[oldStruct.ColumnIndex(oldPks[i])].MaxSize !=
-					newStruct.Columns[newStruct.ColumnIndex(newPks[i])].MaxSize ||
-				oldStruct.Columns[oldStruct.ColumnIndex(oldPks[i])].NotNull !=
-					newStruct.Columns[newStruct.ColumnIndex(newPks[i])].NotNull {
-				bKeyChange = true
-				break
-			}
-		}
-	}
-	if bKeyChange && oldStruct.HasPrimaryKey() {
-		//删除主键
-		if err := p.metaHelper.DropPrimaryKey(tablename); err != nil {
-			return err
-		}
-	}
-	//找出相对应的一对字段
-	oldColumns := oldStruct.Columns
-	newColumns := []*DataColumn{}
-	for _, v := range newStruct.Columns {
-		newColumns = append(newColumns, v)
-	}
-	type FoundColumn struct {
-		OldColumn *DataColumn
-		NewColumn *DataColumn
-	}
-	foundColumns := []FoundColumn{}
-
-	for _, vNew := range newColumns {
-		trueNewName := vNew.Name
-
-		if vNew.OriginName() != "" && vNew.Name != vNew.OriginName() {
-			trueNewName = vNew.OriginName()
-		}
-		for _, vOld := range oldColumns {
-			if vOld.Name == trueNewName {
-				foundColumns = append(foundColumns, FoundColumn{vOld, vNew})
-			}
-		}
-	}
-	//删除字段
-	for _, oldColumn := range oldColumns {
-		bFound := false
-		for _, foundColumn := range foundColumns {
-			if oldColumn == foundColumn.OldColumn {
-				bFound = true
-				break
-			}
-		}
-		//找不到的需要删除
-		if !bFound {
-			colOrders.delete(oldColumn.Name)
-			if err := p.metaHelper.DropColumn(tablename, oldColumn.Name); err != nil {
-				return err
-			}
-		}
-	}
+func (p *DBHelper) UpdateStructContext(ctx context.Context, oldStruct, newStruct *DataTable, oldColumnsOrder []string) error {
+	return p.WithContext(ctx).UpdateStruct(oldStruct, newStruct, oldColumnsOrder)
+}
 
-	//修改字段类型或者重命名
-	for _, column := range foundColumns {
-		if column.OldColumn.Name != column.NewColumn.Name {
-			colOrders.rename(column.OldColumn.Name, column.NewColumn.Name)
-		}
-		if err := p.metaHelper.AlterColumn(tablename,
-			&TableColumn{column.OldColumn.Name, column.OldColumn.DataType, column.OldColumn.MaxSize, column.OldColumn.NotNull, column.OldColumn.Desc},
-			&TableColumn{column.NewColumn.Name, column.NewColumn.DataType, column.NewColumn.MaxSize, column.NewColumn.NotNull, column.NewColumn.Desc}); err != nil {
-			return err
-		}
-	}
-	//新增字段
-	for _, newColumn := range newColumns {
-		bFound := false
-		for _, foundColumn := range foundColumns {
-			if newColumn == foundColumn.NewColumn {
-				bFound = true
-				break
-			}
-		}
-		if !bFound {
-			if newColumn.Index() == 0 {
-				colOrders.insert("", newColumn.Name)
-			} else {
-				colOrders.insert(newStruct.Columns[newColumn.Index()-1].Name, newColumn.Name)
-			}
-			if err := p.metaHelper.AddColumn(tablename, &TableColumn{newColumn.Name, newColumn.DataType, newColumn.MaxSize, newColumn.NotNull, newColumn.Desc}); err != nil {
-				return err
-			}
-		}
-	}
-	if bKeyChange && newStruct.HasPrimaryKey() {
-		//创建主键
-		if err := p.metaHelper.AddPrimaryKey(tablename, newStruct.PK); err != nil {
-			return err
-		}
-	}
-	//处理索引
-	//删除不存在的,并修改存在的
-	for idxName, oldIdx := range oldStruct.Indexes {
-		if newIdx, ok := newStruct.Indexes[idxName]; ok {
-			if !oldIdx.Equal(newIdx) {
-				if err := p.metaHelper.AlterIndex(tablename, idxName, oldIdx, newIdx); err != nil {
-					return err
-				}
-			}
-		} else {
-			if err := p.metaHelper.DropIndex(tablename, idxName); err != nil {
-				return err
-			}
-		}
-	}
-	//新增索引
-	for idxName, newIdx := range newStruct.Indexes {
-		if _, ok := oldStruct.Indexes[idxName]; !ok {
-			if err := p.metaHelper.CreateIndex(newStruct.TableName, idxName, newIdx.Columns, newIdx.Unique, newIdx.Desc); err != nil {
-				return err
-			}
-		}
-	}
-	//处理表的描述
-	colOrders.reorder(newStruct.ColumnNames())
-	desc := newStruct.Desc.Clone()
-	desc["ColumnsOrder"] = colOrders.colNames
-	if err := p.metaHelper.AlterTableDesc(newStruct.TableName, desc); err != nil {
+//UpdateStruct change the table struct from the oldStruct to the newStruct,nil oldStruct create the table.
+//it's the PlanStruct then the ExecutePlan:rollback if failed on the TransactionalDDL db,else the rerun resume from the failed step
+func (p *DBHelper) UpdateStruct(oldStruct, newStruct *DataTable, oldColumnsOrder []string) error {
+	plan, err := p.PlanStruct(oldStruct, newStruct, oldColumnsOrder)
+	if err != nil {
 		return err
 	}
-	return nil
+	return p.ExecutePlan(plan)
 }
 func (d *DBHelper) Merge(dest, source string, colNames []string, pkColumns []string, autoUpdate, autoRemove bool, sqlWhere string) error {
 	return d.metaHelper.Merge(dest, source, colNames, pkColumns, autoUpdate, autoRemove, sqlWhere)
 }
+func (d *DBHelper) MergeContext(ctx context.Context, dest, source string, colNames []string, pkColumns []string, autoUpdate, autoRemove bool, sqlWhere string) error {
+	return d.WithContext(ctx).Merge(dest, source, colNames, pkColumns, autoUpdate, autoRemove, sqlWhere)
+}
@@ -1,6 +1,8 @@
 package dbhelper
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -22,3 +24,74 @@ BEGIN
 	RETURN false;
 END`))
 }
+func Test_ConvertSqlError(t *testing.T) {
+	h := NewDBHelper("sqlite3", ":memory:")
+	if _, err := h.ConvertSql("select * from t where a={{ph}", nil); err == nil {
+		t.Error("parse error expected")
+	} else if _, ok := err.(*TemplateError); !ok {
+		t.Errorf("the error %T isn't *TemplateError", err)
+	}
+	if _, err := h.ConvertSql("select {{.a.b.c}}", map[string]interface{}{"a": 1}); err == nil {
+		t.Error("execute error expected")
+	}
+	if strSql, err := h.ConvertSql("select * from t where a={{ph}}", nil); err != nil || strSql != "select * from t where a=?" {
+		t.Errorf("got %q,%v", strSql, err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("MustConvertSql should panic")
+		}
+	}()
+	h.MustConvertSql("{{", nil)
+}
+func Test_QueryRowNotOpen(t *testing.T) {
+	h := NewDBHelper("sqlite3", ":memory:")
+	var v interface{}
+	if err := h.QueryRow("select 1").Scan(&v); err == nil {
+		t.Error("the db not open error expected")
+	}
+}
+func Test_stateErrors(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeDriverName)
+	defer h.Close()
+	if err := h.Open(); !errors.Is(err, ErrAlreadyOpen) {
+		t.Errorf("got %v", err)
+	}
+	if err := h.Commit(); !errors.Is(err, ErrTxNotBegun) {
+		t.Errorf("got %v", err)
+	}
+	if err := h.Rollback(); !errors.Is(err, ErrTxNotBegun) {
+		t.Errorf("got %v", err)
+	}
+}
+
+//the meta without the Bind
+type unboundMeta struct {
+	MetaHelper
+}
+
+func Test_bindMetaHelper(t *testing.T) {
+	h1 := NewDBHelper(fakeDriverName, "")
+	h2 := NewDBHelper(fakeDriverName, "")
+	ctxH := h1.WithContext(context.Background())
+	for _, h := range []*DBHelper{h1, h2, ctxH} {
+		if m := h.metaHelper.(*sqliteMeta); m.DBHelper != h {
+			t.Errorf("the meta of %p bind to %p", h, m.DBHelper)
+		}
+	}
+	if h1.metaHelper == h2.metaHelper || h1.metaHelper == ctxH.metaHelper {
+		t.Error("the DBHelpers share the meta")
+	}
+	if m := driverMetahelpers[fakeDriverName].(*sqliteMeta); m.DBHelper != nil {
+		t.Error("the registered meta is changed")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("the meta without the Bind should panic")
+		}
+		delete(driverMetahelpers, "dbhelper_unbound")
+	}()
+	RegisterMetaHelper("dbhelper_unbound", unboundMeta{})
+}
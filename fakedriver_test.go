@@ -0,0 +1,187 @@
+package dbhelper
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//a fake driver for test,the query return the rows registered by fakeResult,
+//the exec statements are recorded.the fakeDriverName use the sqlite meta,the fakeMysqlDriverName use the mysql meta,
+//the fakePgDriverName use the postgres meta
+const (
+	fakeDriverName      = "dbhelper_fake"
+	fakeMysqlDriverName = "dbhelper_fake_mysql"
+	fakePgDriverName    = "dbhelper_fake_pg"
+)
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+type fakeExec struct {
+	query string
+	args  []driver.Value
+}
+
+var (
+	fakeMutex   sync.Mutex
+	fakeResults = map[string]*fakeRows{}
+	fakeExecs   []fakeExec
+	//BEGIN,COMMIT and ROLLBACK
+	fakeTxs []string
+	//the statement contains the key return the error
+	fakeErrors = map[string]error{}
+	fakeLastID int64
+	//the simulated db,answer the query before the fakeResults and observe the exec,called with the fakeMutex locked
+	fakeQueryFunc func(query string, args []driver.Value) (*fakeRows, bool)
+	fakeExecFunc  func(query string, args []driver.Value)
+)
+
+func init() {
+	sql.Register(fakeDriverName, fakeDriver{})
+	RegisterMetaHelper(fakeDriverName, &sqliteMeta{})
+	sql.Register(fakeMysqlDriverName, fakeDriver{})
+	RegisterMetaHelper(fakeMysqlDriverName, &mysqlMeta{})
+	sql.Register(fakePgDriverName, fakeDriver{})
+	RegisterMetaHelper(fakePgDriverName, &postgresMeta{})
+}
+func fakeOpen(t *testing.T, driverName string) *DBHelper {
+	h := NewDBHelper(driverName, "")
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+func fakeFail(substr string, err error) {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	fakeErrors[substr] = err
+}
+func fakeTxLog() []string {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	return append([]string{}, fakeTxs...)
+}
+
+//the error registered by fakeFail,must be called with the fakeMutex locked
+func fakeError(query string) error {
+	for substr, err := range fakeErrors {
+		if strings.Contains(query, substr) {
+			return err
+		}
+	}
+	return nil
+}
+func fakeResult(query string, columns []string, rows ...[]driver.Value) {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	fakeResults[query] = &fakeRows{columns, rows}
+}
+//take the recorded exec statements,the other fake state is kept
+func fakeDrain() []fakeExec {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	rev := fakeExecs
+	fakeExecs = nil
+	return rev
+}
+func fakeReset() []fakeExec {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	rev := fakeExecs
+	fakeExecs = nil
+	fakeResults = map[string]*fakeRows{}
+	fakeTxs = nil
+	fakeErrors = map[string]error{}
+	fakeLastID = 0
+	fakeQueryFunc, fakeExecFunc = nil, nil
+	return rev
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return c, fakeTx("BEGIN") }
+func (c *fakeConn) Commit() error                             { return fakeTx("COMMIT") }
+func (c *fakeConn) Rollback() error                           { return fakeTx("ROLLBACK") }
+
+func fakeTx(event string) error {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	fakeTxs = append(fakeTxs, event)
+	return nil
+}
+
+//the LastInsertId is the sequence of the INSERT
+type fakeExecResult int64
+
+func (r fakeExecResult) LastInsertId() (int64, error) { return int64(r), nil }
+func (r fakeExecResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeStmt struct {
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	if err := fakeError(s.query); err != nil {
+		return nil, err
+	}
+	fakeExecs = append(fakeExecs, fakeExec{s.query, args})
+	if fakeExecFunc != nil {
+		fakeExecFunc(s.query, args)
+	}
+	if strings.HasPrefix(s.query, "INSERT") {
+		fakeLastID++
+		return fakeExecResult(fakeLastID), nil
+	}
+	return driver.RowsAffected(1), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	if err := fakeError(s.query); err != nil {
+		return nil, err
+	}
+	var r *fakeRows
+	ok := false
+	if fakeQueryFunc != nil {
+		r, ok = fakeQueryFunc(s.query, args)
+	}
+	if !ok {
+		r, ok = fakeResults[s.query]
+	}
+	if !ok {
+		return nil, fmt.Errorf("the fake result of %q not found", s.query)
+	}
+	return &fakeCursor{r, 0}, nil
+}
+
+type fakeCursor struct {
+	r   *fakeRows
+	pos int
+}
+
+func (c *fakeCursor) Columns() []string { return c.r.columns }
+func (c *fakeCursor) Close() error      { return nil }
+func (c *fakeCursor) Next(dest []driver.Value) error {
+	if c.pos >= len(c.r.rows) {
+		return io.EOF
+	}
+	copy(dest, c.r.rows[c.pos])
+	c.pos++
+	return nil
+}
@@ -0,0 +1,100 @@
+package dbhelper
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+//QueryEvent is the statement executed by the DBHelper
+type QueryEvent struct {
+	//query,queryrow,exec,prepare
+	Op   string
+	SQL  string
+	Args []interface{}
+	InTx bool
+	//the fields below are set after the statement executed
+	Duration time.Duration
+	//-1 if not exec
+	RowsAffected int64
+	Err          error
+}
+
+//QueryHook observe every statement executed by the DBHelper,include the statements of
+//SaveChange and the MetaHelper(UpdateStruct,Merge...).
+//the ctx returned by BeforeQuery is used to execute the statement and passed to AfterQuery
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, e *QueryEvent) context.Context
+	AfterQuery(ctx context.Context, e *QueryEvent)
+}
+
+//AddQueryHook install the hook,the BeforeQuery is called in the order of added,the AfterQuery in reverse.
+//it isn't safe for concurrent use,should be called before the DBHelper used,
+//the DBHelper returned by Begin and WithContext has the hooks of h at that time
+func (h *DBHelper) AddQueryHook(hook QueryHook) {
+	h.hooks = append(h.hooks[:len(h.hooks):len(h.hooks)], hook)
+}
+
+//run the statement with the hooks,run return the rows affected
+func (h *DBHelper) trace(ctx context.Context, op, strSql string, args []interface{}, run func(ctx context.Context) (int64, error)) error {
+	if len(h.hooks) == 0 {
+		_, err := run(ctx)
+		return err
+	}
+	e := &QueryEvent{Op: op, SQL: strSql, Args: args, InTx: h.tx != nil, RowsAffected: -1}
+	for _, hook := range h.hooks {
+		ctx = hook.BeforeQuery(ctx, e)
+	}
+	begin := time.Now()
+	e.RowsAffected, e.Err = run(ctx)
+	e.Duration = time.Since(begin)
+	for i := len(h.hooks) - 1; i >= 0; i-- {
+		h.hooks[i].AfterQuery(ctx, e)
+	}
+	return e.Err
+}
+
+//SlogHook log the statements by the slog.Logger,the error is logged at the error level,
+//the statement slower than the SlowThreshold at the warn level,others at the debug level
+type SlogHook struct {
+	Logger *slog.Logger
+	//0 not check the slow statement
+	SlowThreshold time.Duration
+}
+
+//NewSlogHook create the SlogHook,the nil logger is the slog.Default()
+func NewSlogHook(logger *slog.Logger, slowThreshold time.Duration) *SlogHook {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogHook{Logger: logger, SlowThreshold: slowThreshold}
+}
+func (s *SlogHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+func (s *SlogHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	level, msg := slog.LevelDebug, "sql"
+	switch {
+	case e.Err != nil:
+		level, msg = slog.LevelError, "sql fail"
+	case s.SlowThreshold > 0 && e.Duration >= s.SlowThreshold:
+		level, msg = slog.LevelWarn, "slow sql"
+	}
+	if !s.Logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("op", e.Op),
+		slog.String("sql", e.SQL),
+		slog.Any("args", e.Args),
+		slog.Duration("duration", e.Duration),
+		slog.Bool("tx", e.InTx),
+	}
+	if e.RowsAffected >= 0 {
+		attrs = append(attrs, slog.Int64("rows", e.RowsAffected))
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.Any("error", e.Err))
+	}
+	s.Logger.LogAttrs(ctx, level, msg, attrs...)
+}
@@ -0,0 +1,56 @@
+package dbhelper
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type recordHook struct {
+	events []QueryEvent
+}
+
+func (r *recordHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context { return ctx }
+func (r *recordHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	r.events = append(r.events, *e)
+}
+func Test_QueryHook(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := NewDBHelper(fakeDriverName, "")
+	rec := &recordHook{}
+	h.AddQueryHook(rec)
+	buf := &bytes.Buffer{}
+	h.AddQueryHook(NewSlogHook(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn})), 0))
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if _, err := h.Exec("update t set a={{ph}}", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.InTx(func(th *DBHelper) error {
+		_, err := th.Exec("delete from t")
+		return err
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h.QueryOne("select a from t")
+	if len(rec.events) != 3 {
+		t.Fatalf("got %d events,expect 3", len(rec.events))
+	}
+	if e := rec.events[0]; e.Op != "exec" || e.SQL != "update t set a=?" || len(e.Args) != 1 || e.RowsAffected != 1 || e.InTx {
+		t.Errorf("the event %#v", e)
+	}
+	if e := rec.events[1]; !e.InTx {
+		t.Errorf("the event %#v should in the trans", e)
+	}
+	if e := rec.events[2]; e.Op != "queryrow" || e.Err == nil {
+		t.Errorf("the event %#v should fail", e)
+	}
+	if strings.Count(buf.String(), "\n") != 1 || !strings.Contains(buf.String(), "level=ERROR") {
+		t.Errorf("the log %q should only have the error", buf.String())
+	}
+}
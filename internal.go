@@ -1,6 +1,8 @@
 package dbhelper
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -17,30 +19,213 @@ var (
 func ERROR_ColumnNotFound(tabColName string) error {
 	return fmt.Errorf("the column [%s] not found", tabColName)
 }
-func buildInsertSql(table *DataTable) string {
-	cols := table.ColumnNames()
-	params := make([]string, table.ColumnCount())
-	for i := 0; i < table.ColumnCount(); i++ {
+//insert n rows in one statement,the params is the values of the rows one by one
+func buildInsertRowsSql(tablename string, cols []string, n int) string {
+	if n == 1 {
+		return buildInsertColumnsSql(tablename, cols)
+	}
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = "(" + valuesPlaceholder(len(cols)) + ")"
+	}
+	return fmt.Sprintf("INSERT INTO %s(\n\t%s)VALUES\n\t%s", tablename, strings.Join(cols, ",\n\t"), strings.Join(rows, ",\n\t"))
+}
+func buildInsertColumnsSql(tablename string, cols []string) string {
+	params := make([]string, len(cols))
+	for i := 0; i < len(cols); i++ {
 		params[i] = "{{ph}}"
 	}
-	return fmt.Sprintf("INSERT INTO %s(\n\t%s)VALUES(\n\t%s)", table.TableName, strings.Join(cols, ",\n\t"), strings.Join(params, ",\n\t"))
+	return fmt.Sprintf("INSERT INTO %s(\n\t%s)VALUES(\n\t%s)", tablename, strings.Join(cols, ",\n\t"), strings.Join(params, ",\n\t"))
+}
+//the update sql of SaveChange,the params is the values of the setCols then the origin values of the where params
+func buildUpdateSql(table *DataTable, setCols []string, eq NullSafeEqualer) (string, []string) {
+	where, params := buildCompareWhere(eq, saveWhereColumns(table, true), table.PK)
+	return fmt.Sprintf("UPDATE %s SET\n\t%s\nWHERE\n\t%s", table.TableName, strings.Join(setList(setCols), ",\n\t"), where), params
 }
-func buildUpdateSql(table *DataTable) string {
-	sets := make([]string, table.ColumnCount())
-	wheres := make([]string, table.ColumnCount())
-	for i := 0; i < table.ColumnCount(); i++ {
-		sets[i] = fmt.Sprintf("%s = {{ph}}", table.Columns[i].Name)
-		wheres[i] = fmt.Sprintf("%s = {{ph}}", table.Columns[i].Name)
+
+//the prepared update statement of SaveChange
+type updateStmt struct {
+	strSql      string
+	whereParams []string
+	stmt        *sql.Stmt
+}
+
+func prepareUpdate(ctx context.Context, h *DBHelper, table *DataTable, setCols []string, eq NullSafeEqualer) (*updateStmt, error) {
+	strSql, whereParams := buildUpdateSql(table, setCols, eq)
+	strSql, err := h.ConvertSql(strSql, nil)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := h.prepareTx(ctx, strSql)
+	if err != nil {
+		return nil, h.sqlError("[prepare]\n"+strSql, err)
 	}
-	return fmt.Sprintf("UPDATE %s SET\n\t%s\nWHERE\n\t%s", table.TableName, strings.Join(sets, ",\n\t"), strings.Join(wheres, " AND\n\t"))
+	return &updateStmt{strSql, whereParams, stmt}, nil
+}
 
+//the columns can be inserted and updated,the computed columns are omitted
+func writableColumns(table *DataTable) []string {
+	rev := []string{}
+	for _, c := range table.Columns {
+		if c.Computed == "" {
+			rev = append(rev, c.Name)
+		}
+	}
+	return rev
 }
-func buildDeleteSql(table *DataTable) string {
-	params := make([]string, len(table.PK))
-	for i, c := range table.PK {
+
+//the columns of the row that the value changed,the version column is always changed
+func changedColumns(table *DataTable, r *datatable.DataRow) []string {
+	if r.OriginData == nil {
+		return writableColumns(table)
+	}
+	rev := []string{}
+	for i, c := range table.Columns {
+		if c.Computed == "" && !valueEqual(r.Data[i], r.OriginData[i]) {
+			rev = append(rev, c.Name)
+		}
+	}
+	return rev
+}
+func valueEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	case []byte:
+		bv, ok := b.([]byte)
+		return ok && bytes.Equal(av, bv)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+//the params is the value of sets then the value of wheres
+func buildUpdateColumnsSql(tablename string, setCols, whereCols []string) string {
+	where, _ := buildCompareWhere(nil, whereCols, whereCols)
+	return fmt.Sprintf("UPDATE %s SET\n\t%s\nWHERE\n\t%s", tablename, strings.Join(setList(setCols), ",\n\t"), where)
+
+}
+func setList(cols []string) []string {
+	rev := make([]string, len(cols))
+	for i, c := range cols {
+		rev[i] = fmt.Sprintf("%s = {{ph}}", c)
+	}
+	return rev
+}
+
+//the where clause compare the columns with the params,the column not in the primary key may be null,
+//compared by the NullSafeEqualer,or (col IS NULL AND param IS NULL OR col = param) if eq is nil.
+//return the where and the column of every param in order
+func buildCompareWhere(eq NullSafeEqualer, cols, pkColumns []string) (string, []string) {
+	wheres := make([]string, len(cols))
+	params := make([]string, 0, len(cols))
+	for i, c := range cols {
+		switch {
+		case stringIn(c, pkColumns):
+			wheres[i] = fmt.Sprintf("%s = {{ph}}", c)
+			params = append(params, c)
+		case eq != nil:
+			wheres[i] = eq.NullSafeEqual(c, "{{ph}}")
+			params = append(params, c)
+		default:
+			wheres[i] = fmt.Sprintf("(%s IS NULL AND {{ph}} IS NULL OR %s = {{ph}})", c, c)
+			params = append(params, c, c)
+		}
+	}
+	return strings.Join(wheres, " AND\n\t"), params
+}
+func stringIn(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+//the delete sql of SaveChange,return the column of every param
+func buildDeleteSql(table *DataTable, eq NullSafeEqualer) (string, []string) {
+	where, params := buildCompareWhere(eq, saveWhereColumns(table, false), table.PK)
+	return fmt.Sprintf("DELETE FROM %s WHERE\n\t%s", table.TableName, where), params
+}
+
+//the where columns used by SaveChange:the primary key and the version column if declared,
+//else the primary key only when delete or PKOnly,else all the columns
+func saveWhereColumns(table *DataTable, update bool) []string {
+	if ver := table.VersionColumn(); ver != "" {
+		return append(append([]string{}, table.PK...), ver)
+	}
+	if update && !table.PKOnly() {
+		return table.ColumnNames()
+	}
+	return table.PK
+}
+
+//the origin values of the columns,the inserted row has no origin values
+func originValues(table *DataTable, r *datatable.DataRow, cols []string) []interface{} {
+	if r.OriginData == nil {
+		return columnValues(table, r.Data, cols)
+	}
+	return columnValues(table, r.OriginData, cols)
+}
+func columnValues(table *DataTable, data []interface{}, cols []string) []interface{} {
+	rev := make([]interface{}, len(cols))
+	for i, c := range cols {
+		rev[i] = data[table.ColumnIndex(c)]
+	}
+	return rev
+}
+
+//the next value of the row version,time column is now,other is integer +1(nil is 1)
+func nextVersion(col *DataColumn, v interface{}) (interface{}, error) {
+	if col.DataType == datatable.Time {
+		return time.Now(), nil
+	}
+	switch tv := v.(type) {
+	case nil:
+		return int64(1), nil
+	case int64:
+		return tv + 1, nil
+	case int:
+		return tv + 1, nil
+	case int32:
+		return tv + 1, nil
+	case float64:
+		return tv + 1, nil
+	default:
+		return nil, fmt.Errorf("the version column %s value %v(%T) can't be increased", col.Name, v, v)
+	}
+}
+
+//set the new version of the rows
+func setVersion(table *DataTable, rows []*datatable.DataRow, insert bool) error {
+	ver := table.VersionColumn()
+	if ver == "" {
+		return nil
+	}
+	idx := table.ColumnIndex(ver)
+	if idx < 0 {
+		return fmt.Errorf("the version column %s of the table %s not found", ver, table.TableName)
+	}
+	for _, r := range rows {
+		if insert && r.Data[idx] != nil {
+			continue
+		}
+		//由原始版本计算,保存失败后重试不会重复增加
+		v, err := nextVersion(table.Columns[idx], originValues(table, r, []string{ver})[0])
+		if err != nil {
+			return err
+		}
+		r.Data[idx] = v
+	}
+	return nil
+}
+func buildDeleteColumnsSql(tablename string, whereCols []string) string {
+	params := make([]string, len(whereCols))
+	for i, c := range whereCols {
 		params[i] = fmt.Sprintf("%s = {{ph}}", c)
 	}
-	return fmt.Sprintf("DELETE FROM %s WHERE\n\t%s", table.TableName, strings.Join(params, " AND\n\t"))
+	return fmt.Sprintf("DELETE FROM %s WHERE\n\t%s", tablename, strings.Join(params, " AND\n\t"))
 
 }
 func buildSelectSql(table *DataTable) string {
@@ -51,77 +236,137 @@ func buildSelectSql(table *DataTable) string {
 	return fmt.Sprintf("SELECT\n\t%s\nFROM\n\t%s\nWHERE\n\t%s", strings.Join(table.ColumnNames(), ",\n\t"), table.TableName, strings.Join(params, " AND\n\t"))
 
 }
-func internalUpdateTableTx(tx *sql.Tx, table *DataTable, pp func(string, map[string]interface{}) string) (rcount int64, result_err error) {
+//save the change of the table,h must be bind to a transaction
+func internalUpdateTableTx(ctx context.Context, h *DBHelper, table *DataTable) (rcount int64, err error) {
 	changes := table.GetChange()
 	if changes.RowCount == 0 {
 		return
 	}
+	var iCount int64
+	var conflicts, updateConflicts [][]interface{}
+	if rcount, conflicts, err = deleteRows(ctx, h, table, changes.DeleteRows); err != nil {
+		return
+	}
+	if iCount, updateConflicts, err = updateRows(ctx, h, table, changes.UpdateRows); err != nil {
+		return
+	}
+	rcount += iCount
+	if conflicts = append(conflicts, updateConflicts...); len(conflicts) > 0 {
+		err = &ConcurrentUpdateError{TableName: table.TableName, Keys: conflicts}
+		return
+	}
+	if iCount, err = h.insertChangeRows(ctx, table, changes.InsertRows); err != nil {
+		return
+	}
+	rcount += iCount
+	return
+}
+
+//insert the rows of the change,use the BulkLoader if the rows reach the BulkLoadThreshold
+func (h *DBHelper) insertChangeRows(ctx context.Context, table *DataTable, rows []*datatable.DataRow) (int64, error) {
+	threshold := h.saveOptions.BulkLoadThreshold
+	return insertRows(ctx, h, table, rows, threshold > 0 && len(rows) >= threshold)
+}
+
+//delete the rows,return the primary key of the rows not found when the table has version column
+func deleteRows(ctx context.Context, h *DBHelper, table *DataTable, rows []*datatable.DataRow) (rcount int64, conflicts [][]interface{}, err error) {
+	if len(rows) == 0 {
+		return
+	}
+	eq, _ := h.metaHelper.(NullSafeEqualer)
+	strSql, whereParams := buildDeleteSql(table, eq)
+	if strSql, err = h.ConvertSql(strSql, nil); err != nil {
+		return
+	}
 	var stmt *sql.Stmt
+	if stmt, err = h.prepareTx(ctx, strSql); err != nil {
+		err = h.sqlError("[prepare]\n"+strSql, err)
+		return
+	}
+	defer stmt.Close()
 	var result sql.Result
 	var iCount int64
-	if len(changes.DeleteRows) > 0 {
-		strSql := buildDeleteSql(table)
-		if stmt, result_err = tx.Prepare(pp(strSql, nil)); result_err != nil {
-			result_err = NewSqlError("[prepare]\n"+strSql, result_err)
+	for _, r := range rows {
+		args := originValues(table, r, whereParams)
+		if result, err = h.execStmt(ctx, stmt, strSql, args); err != nil {
+			err = h.sqlError(strSql, err, args...)
 			return
 		}
-		for _, r := range changes.DeleteRows {
-			pkValues := make([]interface{}, len(table.PK))
-			for i, pkColumn := range table.PK {
-				if r.OriginData != nil {
-					pkValues[i] = r.OriginData[table.ColumnIndex(pkColumn)]
-				} else {
-					pkValues[i] = r.Data[table.ColumnIndex(pkColumn)]
-				}
-			}
-			if result, result_err = stmt.Exec(pkValues...); result_err != nil {
-				result_err = NewSqlError(strSql, result_err, pkValues...)
-				return
-			}
-			if iCount, result_err = result.RowsAffected(); result_err != nil {
-				return
-			}
-			rcount += iCount
-
+		if iCount, err = result.RowsAffected(); err != nil {
+			return
+		}
+		//有版本列时,删除不到记录说明被其他人修改了
+		if iCount == 0 && table.VersionColumn() != "" {
+			conflicts = append(conflicts, originValues(table, r, table.PK))
 		}
+		rcount += iCount
 	}
-	if len(changes.UpdateRows) > 0 {
-		strSql := buildUpdateSql(table)
-		if stmt, result_err = tx.Prepare(pp(strSql, nil)); result_err != nil {
-			result_err = NewSqlError("[prepare]\n"+strSql, result_err)
-			return
+	return
+}
+
+//update the rows,return the primary key of the rows not updated
+func updateRows(ctx context.Context, h *DBHelper, table *DataTable, rows []*datatable.DataRow) (rcount int64, conflicts [][]interface{}, err error) {
+	if len(rows) == 0 {
+		return
+	}
+	if err = setVersion(table, rows, false); err != nil {
+		return
+	}
+	eq, _ := h.metaHelper.(NullSafeEqualer)
+	changedOnly := table.UpdateChangedOnly()
+	//每种更新列组合一个语句
+	stmts := map[string]*updateStmt{}
+	defer func() {
+		for _, us := range stmts {
+			us.stmt.Close()
 		}
-		for _, r := range changes.UpdateRows {
-			if result, result_err = stmt.Exec(append(r.Data, r.OriginData...)...); result_err != nil {
-				result_err = NewSqlError(strSql, result_err, append(r.Data, r.OriginData...)...)
-				return
+	}()
+	var result sql.Result
+	var iCount int64
+	for _, r := range rows {
+		setCols := writableColumns(table)
+		if changedOnly {
+			if setCols = changedColumns(table, r); len(setCols) == 0 {
+				continue
 			}
-			if iCount, result_err = result.RowsAffected(); result_err != nil {
+		}
+		key := strings.Join(setCols, ",")
+		us, ok := stmts[key]
+		if !ok {
+			if us, err = prepareUpdate(ctx, h, table, setCols, eq); err != nil {
 				return
 			}
-			if iCount == 0 {
-				result_err = NewSqlError(strSql, fmt.Errorf("record can't update,maybe other user changed the record"), append(r.Data, r.OriginData...)...)
-			}
-			rcount += iCount
+			stmts[key] = us
 		}
-	}
-
-	if len(changes.InsertRows) > 0 {
-		strSql := buildInsertSql(table)
-		if stmt, result_err = tx.Prepare(pp(strSql, nil)); result_err != nil {
-			result_err = NewSqlError("[prepare]\n"+strSql, result_err)
+		args := append(columnValues(table, r.Data, setCols), originValues(table, r, us.whereParams)...)
+		if result, err = h.execStmt(ctx, us.stmt, us.strSql, args); err != nil {
+			err = h.sqlError(us.strSql, err, args...)
 			return
 		}
-		for _, r := range changes.InsertRows {
-			if _, result_err = stmt.Exec(r.Data...); result_err != nil {
-				result_err = NewSqlError(strSql, result_err, r.Data...)
-				return
-			}
-			rcount += 1
+		if iCount, err = result.RowsAffected(); err != nil {
+			return
+		}
+		if iCount == 0 {
+			conflicts = append(conflicts, originValues(table, r, table.PK))
 		}
+		rcount += iCount
 	}
 	return
 }
+func (h *DBHelper) prepareTx(ctx context.Context, strSql string) (stmt *sql.Stmt, err error) {
+	err = h.trace(ctx, "prepare", strSql, nil, func(ctx context.Context) (int64, error) {
+		stmt, err = h.tx.PrepareContext(ctx, strSql)
+		return -1, err
+	})
+	return
+}
+func (h *DBHelper) execStmt(ctx context.Context, stmt *sql.Stmt, strSql string, args []interface{}) (result sql.Result, err error) {
+	err = h.trace(ctx, "exec", strSql, args, func(ctx context.Context) (int64, error) {
+		result, err = stmt.ExecContext(ctx, args...)
+		return rowsAffected(result, err)
+	})
+	return
+}
 func internalRowsFillTable(rows *sql.Rows, table *DataTable, maxRow int64, firstRead bool) (eof bool, err error) {
 	//先建立实际字段与扫描字段的顺序对应关系
 	var cols []string
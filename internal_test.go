@@ -0,0 +1,69 @@
+package dbhelper
+
+import (
+	"errors"
+	"github.com/linlexing/datatable.go"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_nextVersion(t *testing.T) {
+	intCol := NewDataColumn("ver", datatable.Int64, 0, false)
+	if v, err := nextVersion(intCol, nil); err != nil || v != int64(1) {
+		t.Errorf("got %v,%v,expect 1", v, err)
+	}
+	if v, err := nextVersion(intCol, int64(5)); err != nil || v != int64(6) {
+		t.Errorf("got %v,%v,expect 6", v, err)
+	}
+	if _, err := nextVersion(intCol, "x"); err == nil {
+		t.Error("the string version should fail")
+	}
+	timeCol := NewDataColumn("ts", datatable.Time, 0, false)
+	if v, err := nextVersion(timeCol, nil); err != nil || reflect.TypeOf(v) != reflect.TypeOf(time.Time{}) {
+		t.Errorf("got %v,%v,expect the time", v, err)
+	}
+}
+func Test_ConcurrentUpdateError(t *testing.T) {
+	var err error = &ConcurrentUpdateError{TableName: "t", Keys: [][]interface{}{{1}}}
+	if ErrorKindOf(err) != ErrorConcurrentUpdate || !errors.Is(err, ErrConcurrentUpdate) {
+		t.Errorf("the kind of %v", err)
+	}
+}
+func Test_buildCompareWhere(t *testing.T) {
+	cases := []struct {
+		eq     NullSafeEqualer
+		where  string
+		params []string
+	}{
+		{&sqliteMeta{}, "id = {{ph}} AND\n\tname IS {{ph}}", []string{"id", "name"}},
+		{&postgresMeta{}, "id = {{ph}} AND\n\tname IS NOT DISTINCT FROM {{ph}}", []string{"id", "name"}},
+		{&mysqlMeta{}, "id = {{ph}} AND\n\tname <=> {{ph}}", []string{"id", "name"}},
+		{nil, "id = {{ph}} AND\n\t(name IS NULL AND {{ph}} IS NULL OR name = {{ph}})", []string{"id", "name", "name"}},
+	}
+	for _, c := range cases {
+		where, params := buildCompareWhere(c.eq, []string{"id", "name"}, []string{"id"})
+		if where != c.where || !reflect.DeepEqual(params, c.params) {
+			t.Errorf("%T got %q %v,expect %q %v", c.eq, where, params, c.where, c.params)
+		}
+	}
+}
+func Test_valueEqual(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		a, b  interface{}
+		equal bool
+	}{
+		{nil, nil, true},
+		{int64(1), int64(1), true},
+		{int64(1), nil, false},
+		{[]byte("a"), []byte("a"), true},
+		{now, now.UTC(), true},
+		{now, now.Add(time.Second), false},
+	}
+	for _, c := range cases {
+		if valueEqual(c.a, c.b) != c.equal {
+			t.Errorf("%v equal %v expect %v", c.a, c.b, c.equal)
+		}
+	}
+}
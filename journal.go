@@ -0,0 +1,220 @@
+package dbhelper
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/linlexing/datatable.go"
+	"time"
+)
+
+//the journal table of the migration,created by the ExecutePlan when the MetaHelper not support the transactional DDL
+const MigrationJournalTable = "dbhelper_migration"
+
+const (
+	MigrationStepDone   = "done"
+	MigrationStepFailed = "failed"
+	MigrationStepSkip   = "skip"
+)
+
+//TransactionalDDL is implemented by the MetaHelper that can rollback the DDL in the transaction,
+//the ExecutePlan run all steps in one transaction,otherwise the progress is recorded to the journal
+type TransactionalDDL interface {
+	TransactionalDDL() bool
+}
+
+//MigrationRecord is one row of the MigrationJournalTable
+type MigrationRecord struct {
+	PlanID    string    `db:"plan_id"`
+	Step      int64     `db:"step"`
+	TableName string    `db:"table_name"`
+	Op        string    `db:"op"`
+	Name      string    `db:"name"`
+	Status    string    `db:"status"`
+	Message   string    `db:"message"`
+	Finished  time.Time `db:"finished"`
+}
+
+//MigrationError is returned by the ExecutePlan when a step failed
+type MigrationError struct {
+	TableName string
+	PlanID    string
+	Step      int
+	Op        MigrationOp
+	Name      string
+	//the executed steps are rolled back,else the rerun of the plan resume from the failed step
+	RolledBack bool
+	Err        error
+}
+
+func (m *MigrationError) Error() string {
+	return fmt.Sprintf("migrate table %s failed at step %d(%s %s):%v", m.TableName, m.Step, m.Op, m.Name, m.Err)
+}
+func (m *MigrationError) Unwrap() error {
+	return m.Err
+}
+
+//ID return the hash of the steps,the same plan has the same ID
+func (m *MigrationPlan) ID() string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n", m.TableName)
+	for _, step := range m.Steps {
+		fmt.Fprintf(h, "%s\t%s\n", step.Op, step.Name)
+		for _, strSql := range step.SQL {
+			fmt.Fprintf(h, "%s\n", strSql)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func transactionalDDL(m MetaHelper) bool {
+	t, ok := m.(TransactionalDDL)
+	return ok && t.TransactionalDDL()
+}
+
+//all steps in one transaction,rollback if failed
+func (p *DBHelper) executePlanInTx(plan *MigrationPlan) error {
+	return p.inDDLTx(plan.TableName, func(th *DBHelper) error {
+		for i, step := range plan.Steps {
+			if err := step.execute(th); err != nil {
+				return &MigrationError{plan.TableName, plan.ID(), i, step.Op, step.Name, true, err}
+			}
+		}
+		return nil
+	})
+}
+
+//the steps are recorded in the journal,the done or skipped steps of the same plan are ignored
+func (p *DBHelper) executePlanJournal(plan *MigrationPlan) error {
+	if err := p.ensureMigrationJournal(); err != nil {
+		return err
+	}
+	planID := plan.ID()
+	records, err := p.planRecords(planID)
+	if err != nil {
+		return err
+	}
+	finished := map[int64]bool{}
+	for _, r := range records {
+		if r.Status == MigrationStepDone || r.Status == MigrationStepSkip {
+			finished[r.Step] = true
+		}
+	}
+	for i, step := range plan.Steps {
+		if finished[int64(i)] {
+			continue
+		}
+		if err := step.execute(p); err != nil {
+			merr := &MigrationError{plan.TableName, planID, i, step.Op, step.Name, false, err}
+			if rerr := p.recordMigrationStep(plan, i, MigrationStepFailed, err.Error()); rerr != nil {
+				return fmt.Errorf("%v,record the journal error:%v", merr, rerr)
+			}
+			return merr
+		}
+		if err := p.recordMigrationStep(plan, i, MigrationStepDone, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *DBHelper) ensureMigrationJournal() error {
+	exists, err := p.metaHelper.TableExists(MigrationJournalTable)
+	if err != nil || exists {
+		return err
+	}
+	table := NewDataTable(MigrationJournalTable)
+	table.AddColumn(NewDataColumn("plan_id", datatable.String, 40, true))
+	table.AddColumn(NewDataColumn("step", datatable.Int64, 0, true))
+	table.AddColumn(NewDataColumn("table_name", datatable.String, 200, true))
+	table.AddColumn(NewDataColumn("op", datatable.String, 50, true))
+	table.AddColumn(NewDataColumn("name", datatable.String, 200, true))
+	table.AddColumn(NewDataColumn("status", datatable.String, 10, true))
+	table.AddColumn(NewDataColumn("message", datatable.String, 0, true))
+	table.AddColumn(NewDataColumn("finished", datatable.Time, 0, true))
+	table.SetPK("plan_id", "step")
+	return p.metaHelper.CreateTable(table)
+}
+
+func (p *DBHelper) planRecords(planID string) ([]MigrationRecord, error) {
+	return Select[MigrationRecord](p, fmt.Sprintf(
+		"SELECT plan_id,step,table_name,op,name,status,message,finished FROM %s WHERE plan_id={{ph}} ORDER BY step",
+		MigrationJournalTable), planID)
+}
+
+func (p *DBHelper) recordMigrationStep(plan *MigrationPlan, step int, status, message string) error {
+	planID := plan.ID()
+	if _, err := p.Exec(fmt.Sprintf("DELETE FROM %s WHERE plan_id={{ph}} AND step={{ph}}", MigrationJournalTable),
+		planID, step); err != nil {
+		return err
+	}
+	_, err := p.Exec(fmt.Sprintf(
+		"INSERT INTO %s(plan_id,step,table_name,op,name,status,message,finished)VALUES({{ph}},{{ph}},{{ph}},{{ph}},{{ph}},{{ph}},{{ph}},{{ph}})",
+		MigrationJournalTable), planID, step, plan.TableName, string(plan.Steps[step].Op), plan.Steps[step].Name,
+		status, message, time.Now())
+	return err
+}
+
+//MigrationJournal return the journal records of the table ordered by the plan and step,
+//empty if the journal table not exists
+func (p *DBHelper) MigrationJournal(tablename string) ([]MigrationRecord, error) {
+	exists, err := p.metaHelper.TableExists(MigrationJournalTable)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return Select[MigrationRecord](p, fmt.Sprintf(
+		"SELECT plan_id,step,table_name,op,name,status,message,finished FROM %s WHERE table_name={{ph}} ORDER BY finished,plan_id,step",
+		MigrationJournalTable), tablename)
+}
+
+//PendingSteps return the index of the steps not done in the journal,
+//all steps if the plan is executed in the transaction
+func (p *DBHelper) PendingSteps(plan *MigrationPlan) ([]int, error) {
+	finished := map[int64]bool{}
+	if !transactionalDDL(p.metaHelper) {
+		exists, err := p.metaHelper.TableExists(MigrationJournalTable)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			records, err := p.planRecords(plan.ID())
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range records {
+				if r.Status == MigrationStepDone || r.Status == MigrationStepSkip {
+					finished[r.Step] = true
+				}
+			}
+		}
+	}
+	rev := []int{}
+	for i := range plan.Steps {
+		if !finished[int64(i)] {
+			rev = append(rev, i)
+		}
+	}
+	return rev, nil
+}
+
+//SkipMigrationStep mark the step as finished,used after the failed step is repaired by hand,
+//the rerun of the plan resume from the next step
+func (p *DBHelper) SkipMigrationStep(plan *MigrationPlan, step int) error {
+	if step < 0 || step >= len(plan.Steps) {
+		return fmt.Errorf("the step %d out of range,the plan has %d steps", step, len(plan.Steps))
+	}
+	if err := p.ensureMigrationJournal(); err != nil {
+		return err
+	}
+	return p.recordMigrationStep(plan, step, MigrationStepSkip, "")
+}
+
+//ResetMigration remove the journal of the plan,the rerun of the plan execute all steps
+func (p *DBHelper) ResetMigration(plan *MigrationPlan) error {
+	exists, err := p.metaHelper.TableExists(MigrationJournalTable)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = p.Exec(fmt.Sprintf("DELETE FROM %s WHERE plan_id={{ph}}", MigrationJournalTable), plan.ID())
+	return err
+}
@@ -0,0 +1,236 @@
+package dbhelper
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMigrationPlan_ID(t *testing.T) {
+	plan := func(sqls ...string) *MigrationPlan {
+		p := &MigrationPlan{TableName: "orders"}
+		p.add(&SchemaChange{Op: OpAddColumn, Name: "price"})
+		p.Steps[0].SQL = sqls
+		return p
+	}
+	a := plan("ALTER TABLE orders ADD COLUMN price DECIMAL(10,2)")
+	if a.ID() != plan("ALTER TABLE orders ADD COLUMN price DECIMAL(10,2)").ID() {
+		t.Error("the same plan got the different id")
+	}
+	if a.ID() == plan("ALTER TABLE orders ADD COLUMN price DECIMAL(12,2)").ID() {
+		t.Error("the different plan got the same id")
+	}
+	if len(a.ID()) != 40 {
+		t.Errorf("the id %q is not sha1", a.ID())
+	}
+	if !transactionalDDL(&sqliteMeta{}) || !transactionalDDL(&postgresMeta{}) || transactionalDDL(&mysqlMeta{}) {
+		t.Error("the TransactionalDDL flags error")
+	}
+}
+
+//a simulated MigrationJournalTable of the mysql,changed by the statements of the journal
+type fakeJournal struct {
+	exists bool
+	//the key is the plan id and the step
+	rows map[string][]driver.Value
+}
+
+func newFakeJournal() *fakeJournal {
+	rev := &fakeJournal{rows: map[string][]driver.Value{}}
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	fakeExecFunc, fakeQueryFunc = rev.exec, rev.query
+	return rev
+}
+func (f *fakeJournal) exec(query string, args []driver.Value) {
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE "+MigrationJournalTable+"("):
+		f.exists = true
+	case strings.HasPrefix(query, "INSERT INTO "+MigrationJournalTable+"("):
+		f.rows[fmt.Sprint(args[0], "/", args[1])] = args
+	case query == "DELETE FROM "+MigrationJournalTable+" WHERE plan_id=? AND step=?":
+		delete(f.rows, fmt.Sprint(args[0], "/", args[1]))
+	case query == "DELETE FROM "+MigrationJournalTable+" WHERE plan_id=?":
+		for k, row := range f.rows {
+			if row[0] == args[0] {
+				delete(f.rows, k)
+			}
+		}
+	}
+}
+func (f *fakeJournal) query(query string, args []driver.Value) (*fakeRows, bool) {
+	switch query {
+	case "SELECT 1 FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?":
+		if f.exists && args[0] == MigrationJournalTable {
+			return &fakeRows{[]string{"1"}, [][]driver.Value{{int64(1)}}}, true
+		}
+		return &fakeRows{[]string{"1"}, nil}, true
+	case "SELECT plan_id,step,table_name,op,name,status,message,finished FROM " + MigrationJournalTable + " WHERE plan_id=? ORDER BY step":
+		rows := [][]driver.Value{}
+		for _, row := range f.rows {
+			if row[0] == args[0] {
+				rows = append(rows, row)
+			}
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i][1].(int64) < rows[j][1].(int64)
+		})
+		return &fakeRows{[]string{"plan_id", "step", "table_name", "op", "name", "status", "message", "finished"}, rows}, true
+	}
+	return nil, false
+}
+
+//the status of the steps in the journal
+func (f *fakeJournal) status(plan *MigrationPlan) []string {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	rev := []string{}
+	for i := range plan.Steps {
+		if row, ok := f.rows[fmt.Sprint(plan.ID(), "/", int64(i))]; ok {
+			rev = append(rev, row[5].(string))
+		} else {
+			rev = append(rev, "")
+		}
+	}
+	return rev
+}
+
+//the plan add the columns,every step has one statement
+func journalPlan(columns ...string) *MigrationPlan {
+	plan := &MigrationPlan{TableName: "orders"}
+	for _, c := range columns {
+		strSql := "ALTER TABLE orders ADD COLUMN " + c + " INT"
+		plan.Steps = append(plan.Steps, &MigrationStep{Op: OpAddColumn, Name: c, SQL: []string{strSql}})
+	}
+	return plan
+}
+
+//the executed statements of the plan
+func planExecs(execs []fakeExec) []string {
+	rev := []string{}
+	for _, e := range execs {
+		if strings.HasPrefix(e.query, "ALTER TABLE orders ") {
+			rev = append(rev, e.query)
+		}
+	}
+	return rev
+}
+func Test_executePlanJournal(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeMysqlDriverName)
+	defer h.Close()
+	journal := newFakeJournal()
+	plan := journalPlan("a", "b", "c")
+
+	fakeFail("ADD COLUMN b", errors.New("Duplicate column name 'b'"))
+	err := h.ExecutePlan(plan)
+	merr, ok := err.(*MigrationError)
+	if !ok || merr.Step != 1 || merr.RolledBack || merr.PlanID != plan.ID() {
+		t.Fatalf("got %#v", err)
+	}
+	if got := planExecs(fakeDrain()); !reflect.DeepEqual(got, []string{"ALTER TABLE orders ADD COLUMN a INT"}) {
+		t.Errorf("got %q", got)
+	}
+	if got := journal.status(plan); !reflect.DeepEqual(got, []string{MigrationStepDone, MigrationStepFailed, ""}) {
+		t.Errorf("got %q", got)
+	}
+	if pending, err := h.PendingSteps(plan); err != nil || !reflect.DeepEqual(pending, []int{1, 2}) {
+		t.Errorf("got %v,%v", pending, err)
+	}
+
+	//重新执行,从失败的步骤继续
+	fakeFail("ADD COLUMN b", nil)
+	if err = h.ExecutePlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	if got := planExecs(fakeDrain()); !reflect.DeepEqual(got, []string{"ALTER TABLE orders ADD COLUMN b INT", "ALTER TABLE orders ADD COLUMN c INT"}) {
+		t.Errorf("got %q", got)
+	}
+	if got := journal.status(plan); !reflect.DeepEqual(got, []string{MigrationStepDone, MigrationStepDone, MigrationStepDone}) {
+		t.Errorf("got %q", got)
+	}
+	if pending, err := h.PendingSteps(plan); err != nil || len(pending) != 0 {
+		t.Errorf("got %v,%v", pending, err)
+	}
+	//已完成的计划不再执行
+	if err = h.ExecutePlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	if got := planExecs(fakeDrain()); len(got) != 0 {
+		t.Errorf("got %q", got)
+	}
+
+	//重置后全部重新执行
+	if err = h.ResetMigration(plan); err != nil {
+		t.Fatal(err)
+	}
+	if got := journal.status(plan); !reflect.DeepEqual(got, []string{"", "", ""}) {
+		t.Errorf("got %q", got)
+	}
+	if pending, err := h.PendingSteps(plan); err != nil || !reflect.DeepEqual(pending, []int{0, 1, 2}) {
+		t.Errorf("got %v,%v", pending, err)
+	}
+}
+func TestDBHelper_SkipMigrationStep(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeMysqlDriverName)
+	defer h.Close()
+	journal := newFakeJournal()
+	plan := journalPlan("a", "b", "c")
+	if err := h.SkipMigrationStep(plan, 3); err == nil {
+		t.Error("the step out of range should fail")
+	}
+	//手工修复失败的步骤后跳过它
+	fakeFail("ADD COLUMN b", errors.New("Duplicate column name 'b'"))
+	if err := h.ExecutePlan(plan); err == nil {
+		t.Fatal("the step b should fail")
+	}
+	fakeDrain()
+	if err := h.SkipMigrationStep(plan, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := journal.status(plan); !reflect.DeepEqual(got, []string{MigrationStepDone, MigrationStepSkip, ""}) {
+		t.Errorf("got %q", got)
+	}
+	if pending, err := h.PendingSteps(plan); err != nil || !reflect.DeepEqual(pending, []int{2}) {
+		t.Errorf("got %v,%v", pending, err)
+	}
+	if err := h.ExecutePlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	if got := planExecs(fakeDrain()); !reflect.DeepEqual(got, []string{"ALTER TABLE orders ADD COLUMN c INT"}) {
+		t.Errorf("got %q", got)
+	}
+}
+func Test_executePlanInTx(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeDriverName)
+	defer h.Close()
+	fakeResult("PRAGMA foreign_keys", []string{"foreign_keys"}, []driver.Value{int64(0)})
+	fakeResult("PRAGMA foreign_key_check", []string{"table", "rowid", "parent", "fkid"})
+	plan := journalPlan("a", "b", "c")
+	fakeFail("ADD COLUMN b", errors.New("duplicate column name: b"))
+	err := h.ExecutePlan(plan)
+	merr, ok := err.(*MigrationError)
+	if !ok || merr.Step != 1 || !merr.RolledBack {
+		t.Fatalf("got %#v", err)
+	}
+	if log := fakeTxLog(); !reflect.DeepEqual(log, []string{"BEGIN", "ROLLBACK"}) {
+		t.Errorf("got %v", log)
+	}
+	//回滚的计划不记录日志
+	sqls, _ := fakeStatements(fakeReset())
+	if !reflect.DeepEqual(sqls, []string{"ALTER TABLE orders ADD COLUMN a INT"}) {
+		t.Errorf("got %q", sqls)
+	}
+	if pending, err := h.PendingSteps(plan); err != nil || !reflect.DeepEqual(pending, []int{0, 1, 2}) {
+		t.Errorf("got %v,%v", pending, err)
+	}
+}
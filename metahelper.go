@@ -3,15 +3,153 @@ package dbhelper
 import (
 	"fmt"
 	"github.com/linlexing/datatable.go"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
+var (
+	numericTypeRegexp = regexp.MustCompile(`(?i)^\s*(?:numeric|decimal)\s*\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\)`)
+	//the type cast of postgres,::character varying
+	exprCastRegexp = regexp.MustCompile(`::[a-z_]+(?: [a-z_]+)*(?:\(\d+(?:,\d+)?\))?`)
+	//the literal in the parentheses,(0)
+	exprLiteralRegexp = regexp.MustCompile(`\((-?[0-9.]+|'[^']*')\)`)
+)
+
+//TableColumn is the column define of the table.Default,Check and Computed are the sql expression,
+//Check is the column check constraint,Computed is the expression of the generated(stored) column.
+//the Float64 column with the Precision is NUMERIC(Precision,Scale)
 type TableColumn struct {
-	Name    string
-	Type    datatable.ColumnType
-	MaxSize int
-	NotNull bool
-	Desc    DBDesc
+	Name      string
+	Type      datatable.ColumnType
+	MaxSize   int
+	NotNull   bool
+	Desc      DBDesc
+	Default   string
+	Check     string
+	Precision int
+	Scale     int
+	Computed  string
+}
+
+//the column define equal,the Desc isn't compared
+func (t *TableColumn) DefineEqual(v *TableColumn) bool {
+	return t.Name == v.Name &&
+		t.Type == v.Type &&
+		t.MaxSize == v.MaxSize &&
+		t.NotNull == v.NotNull &&
+		t.Precision == v.Precision &&
+		t.Scale == v.Scale &&
+		sqlExprEqual(t.Default, v.Default) &&
+		sqlExprEqual(t.Check, v.Check) &&
+		sqlExprEqual(t.Computed, v.Computed)
+}
+//Generated return true if the Desc declare the value is generated by the db,see the DataColumn.Generated
+func (t *TableColumn) Generated() bool {
+	v, _ := t.Desc[DescGenerated].(bool)
+	return v
+}
+
+//the Desc saved to the db and compared by UpdateStruct,the DescGenerated is read from the column define
+func (t *TableColumn) storedDesc() DBDesc {
+	rev := DBDesc{}
+	for k, v := range t.Desc {
+		if k != DescGenerated {
+			rev[k] = v
+		}
+	}
+	return rev
+}
+func newTableColumn(col *DataColumn) *TableColumn {
+	return &TableColumn{col.Name, col.DataType, col.MaxSize, col.NotNull, col.Desc,
+		col.Default, col.Check, col.Precision, col.Scale, col.Computed}
+}
+
+//the expression read from the db is rewritten by the db(the parentheses,type cast,quote),
+//so compare them ignore these
+func sqlExprEqual(a, b string) bool {
+	return normalizeExpr(a) == normalizeExpr(b)
+}
+func normalizeExpr(expr string) string {
+	//字符串常量保持原样
+	buf := make([]byte, 0, len(expr))
+	inString := false
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+		case inString:
+		case c == ' ', c == '\t', c == '\r', c == '\n', c == '`', c == '"':
+			//cast的类型名中的空格需要保留
+			if c == ' ' && len(buf) > 0 && i+1 < len(expr) && isIdentChar(buf[len(buf)-1]) && isIdentChar(expr[i+1]) {
+				buf = append(buf, ' ')
+			}
+			continue
+		case c >= 'A' && c <= 'Z':
+			c += 'a' - 'A'
+		}
+		buf = append(buf, c)
+	}
+	expr = exprCastRegexp.ReplaceAllString(string(buf), "")
+	expr = exprLiteralRegexp.ReplaceAllString(expr, "$1")
+	for strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") && matchedParen(expr, 0) == len(expr)-1 {
+		expr = expr[1 : len(expr)-1]
+	}
+	return expr
+}
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+//the index of the parenthesis matched the one at start,-1 if not found.the string literal is skipped
+func matchedParen(s string, start int) int {
+	depth := 0
+	inString := false
+	for i := start; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+//the db type of the column,the Float64 column with the Precision is NUMERIC(Precision,Scale)
+func columnDBType(column *TableColumn, dbType func(datatable.ColumnType, int) (string, error)) (string, error) {
+	if column.Type == datatable.Float64 && column.Precision > 0 {
+		return fmt.Sprintf("NUMERIC(%d,%d)", column.Precision, column.Scale), nil
+	}
+	return dbType(column.Type, column.MaxSize)
+}
+
+//parse the precision and scale of the NUMERIC(DECIMAL) type
+func parseNumericType(dbType string) (precision, scale int, ok bool) {
+	m := numericTypeRegexp.FindStringSubmatch(dbType)
+	if m == nil {
+		return 0, 0, false
+	}
+	precision, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		scale, _ = strconv.Atoi(m[2])
+	}
+	return precision, scale, true
+}
+
+//the name of the column check constraint
+func checkName(tablename, column string) string {
+	if i := strings.LastIndex(tablename, "."); i > -1 {
+		tablename = tablename[i+1:]
+	}
+	return fmt.Sprintf("%s_%s_check", tablename, column)
 }
 type TableIndex struct {
 	Name    string
@@ -19,6 +157,107 @@ type TableIndex struct {
 	Unique  bool
 	Desc    DBDesc
 }
+type TableForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	OnDelete   string
+	OnUpdate   string
+	Desc       DBDesc
+}
+
+//the columns of the table,used by MetaHelper.CreateTable
+func tableColumns(table *DataTable) []*TableColumn {
+	rev := make([]*TableColumn, len(table.Columns))
+	for i, col := range table.Columns {
+		rev[i] = newTableColumn(col)
+	}
+	return rev
+}
+
+//the indexes of the table order by name,used by MetaHelper.CreateTable
+func tableIndexes(table *DataTable) []*TableIndex {
+	names := []string{}
+	for name := range table.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rev := make([]*TableIndex, len(names))
+	for i, name := range names {
+		idx := table.Indexes[name]
+		rev[i] = &TableIndex{name, idx.Columns, idx.Unique, idx.Desc}
+	}
+	return rev
+}
+
+//the foreign keys of the table order by name,used by MetaHelper.CreateTable
+func tableForeignKeys(table *DataTable) []*TableForeignKey {
+	names := []string{}
+	for name := range table.ForeignKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rev := make([]*TableForeignKey, len(names))
+	for i, name := range names {
+		fk := table.ForeignKeys[name]
+		rev[i] = &TableForeignKey{name, fk.Columns, fk.RefTable, fk.RefColumns, fk.OnDelete, fk.OnUpdate, fk.Desc}
+	}
+	return rev
+}
+
+//the FOREIGN KEY clause,without the CONSTRAINT name
+func foreignKeyClause(fk *TableForeignKey) string {
+	rev := fmt.Sprintf("FOREIGN KEY(%s) REFERENCES %s(%s)",
+		strings.Join(fk.Columns, ","), fk.RefTable, strings.Join(fk.RefColumns, ","))
+	if action := foreignKeyAction(fk.OnDelete); action != "" {
+		rev += " ON DELETE " + action
+	}
+	if action := foreignKeyAction(fk.OnUpdate); action != "" {
+		rev += " ON UPDATE " + action
+	}
+	return rev
+}
+
+//the columns not in the primary key
+func nonKeyColumns(colNames, pkColumns []string) []string {
+	rev := []string{}
+	for _, col := range colNames {
+		bPk := false
+		for _, pk := range pkColumns {
+			if pk == col {
+				bPk = true
+				break
+			}
+		}
+		if !bPk {
+			rev = append(rev, col)
+		}
+	}
+	return rev
+}
+
+//the ON CONFLICT clause of sqlite and postgres,autoUpdate update the columns not in the primary key
+func onConflictClause(colNames, pkColumns []string, autoUpdate bool) string {
+	sets := []string{}
+	for _, col := range nonKeyColumns(colNames, pkColumns) {
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", col, col))
+	}
+	if !autoUpdate || len(sets) == 0 {
+		return fmt.Sprintf("ON CONFLICT(%s) DO NOTHING", strings.Join(pkColumns, ","))
+	}
+	return fmt.Sprintf("ON CONFLICT(%s) DO UPDATE SET\n\t%s", strings.Join(pkColumns, ","), strings.Join(sets, ",\n\t"))
+}
+
+//the values placeholder of the insert
+func valuesPlaceholder(num int) string {
+	params := make([]string, num)
+	for i := range params {
+		params[i] = "{{ph}}"
+	}
+	return strings.Join(params, ",")
+}
+
 type RootMeta struct {
 	DBHelper *DBHelper
 }
@@ -27,13 +266,60 @@ func (r *RootMeta) SetDBHelper(h *DBHelper) {
 	r.DBHelper = h
 	return
 }
+
+//the query of the HealthCheck,the database that not support SELECT without FROM should override it
+func (r *RootMeta) LivenessSql() string {
+	return "SELECT 1"
+}
+
+//run fn in a transaction,the h passed to fn is bind to the transaction.
+//if already in a transaction,fn run in it directly(the ddl of some database commit implicitly,so no savepoint)
+func (r *RootMeta) inTrans(fn func(h *DBHelper) error) error {
+	h := r.DBHelper
+	if h.tx != nil {
+		return fn(h)
+	}
+	return h.InTx(fn, nil)
+}
 func (r *RootMeta) DropTable(tablename string) error {
 	_, err := r.DBHelper.Exec(fmt.Sprintf("DROP TABLE %s", tablename))
 	return err
 }
 func (r *RootMeta) DropColumn(table, column string) error {
-	_, err := r.DBHelper.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column))
-	return err
+	return execStatements(r.DBHelper, []string{dropColumnSql(table, column)})
+}
+func dropColumnSql(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
+}
+func addPrimaryKeySql(table string, pks []string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY(%s)", table, strings.Join(pks, ","))
+}
+
+//execute the statements built by the BuildDDL,the statements are the final sql(no template and params)
+func execStatements(h *DBHelper, stmts []string) error {
+	if h.db == nil {
+		return ErrNotOpen
+	}
+	for _, strSql := range stmts {
+		if _, err := h.execSql(h.context(), strSql, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//build the statements of the changes by the meta and execute them
+func execDDL(h *DBHelper, meta MetaHelper, changes ...*SchemaChange) error {
+	stmts, err := meta.BuildDDL(changes)
+	if err != nil {
+		return err
+	}
+	for _, step := range stmts {
+		if err = execStatements(h, step); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type orderField struct {
@@ -149,6 +435,12 @@ func (r *RootMeta) BuildSelectLimitSql(srcSql string, pkFields []string, startKe
 		limitStr), lstval
 }
 
+//MetaBinder is implemented by the MetaHelper,every DBHelper(and the transaction,WithContext) bind a copy of
+//the registered MetaHelper by Bind,so the MetaHelper operations run on the DBHelper's connection and context.
+//the copy must not share the state that SetDBHelper changed with the receiver
+type MetaBinder interface {
+	Bind(h *DBHelper) MetaHelper
+}
 type MetaHelper interface {
 	SetDBHelper(helper *DBHelper)
 	BuildSelectLimitSql(srcSql string, pkFields []string, startKeyValue map[string]interface{}, selectCols []string, where string, orderby []string, limit int) (string, []interface{})
@@ -177,5 +469,60 @@ type MetaHelper interface {
 	GetIndexes(tablename string) ([]*TableIndex, error)
 	GetColumns(tablename string) ([]*TableColumn, error)
 	GetPrimaryKeys(tablename string) ([]string, error)
+	GetForeignKeys(tablename string) ([]*TableForeignKey, error)
+	AddForeignKey(tablename string, fk *TableForeignKey) error
+	DropForeignKey(tablename, fkname string) error
+	//BuildDDL return the statements of every change without execute them,the statements of a change are built
+	//on the struct changed by the previous changes.the struct of the db can be queried,but not changed
+	BuildDDL(changes []*SchemaChange) ([][]string, error)
 	Merge(dest, source string, colNames []string, pkColumns []string, autoUpdate, autoRemove bool, sqlWhere string) error
 }
+
+//UpsertBuilder is implemented by the MetaHelper that can insert or update a row in one statement,
+//the params of the sql are the values of the cols
+type UpsertBuilder interface {
+	BuildUpsertSql(tablename string, cols, pkColumns []string) string
+}
+
+//SavepointBuilder is implemented by the MetaHelper that support the savepoint,
+//the Begin in a transaction use it to nest the transaction
+type SavepointBuilder interface {
+	SavepointSql(name string) string
+	RollbackToSavepointSql(name string) string
+	ReleaseSavepointSql(name string) string
+}
+
+//the savepoint of the sql standard,embedded by the MetaHelper
+type standardSavepoint struct{}
+
+func (standardSavepoint) SavepointSql(name string) string {
+	return "SAVEPOINT " + name
+}
+func (standardSavepoint) RollbackToSavepointSql(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+func (standardSavepoint) ReleaseSavepointSql(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+//NullSafeEqualer is implemented by the MetaHelper that can compare the column with the param null-safely
+//(NULL equal NULL),the placeholder must appear once in the expression
+type NullSafeEqualer interface {
+	NullSafeEqual(column, placeholder string) string
+}
+
+//ReturningBuilder is implemented by the MetaHelper that can return the values of the inserted row
+//in the INSERT statement(RETURNING,OUTPUT INSERTED),the params of the sql are the values of the cols,
+//the query return the returnCols.if not,the LastInsertId is used for one generated column
+type ReturningBuilder interface {
+	BuildInsertReturningSql(tablename string, cols, returnCols []string) string
+}
+
+//INSERT ... RETURNING
+func insertReturningSql(tablename string, cols, returnCols []string) string {
+	if len(cols) == 0 {
+		return fmt.Sprintf("INSERT INTO %s DEFAULT VALUES RETURNING %s", tablename, strings.Join(returnCols, ","))
+	}
+	return fmt.Sprintf("INSERT INTO %s(%s)VALUES(%s) RETURNING %s",
+		tablename, strings.Join(cols, ","), valuesPlaceholder(len(cols)), strings.Join(returnCols, ","))
+}
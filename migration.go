@@ -0,0 +1,446 @@
+package dbhelper
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//MigrationOp is the kind of the MigrationStep
+type MigrationOp string
+
+const (
+	OpCreateTable    MigrationOp = "create table"
+	OpDropForeignKey MigrationOp = "drop foreign key"
+	OpDropPrimaryKey MigrationOp = "drop primary key"
+	OpDropColumn     MigrationOp = "drop column"
+	OpAlterColumn    MigrationOp = "alter column"
+	OpAddColumn      MigrationOp = "add column"
+	OpAddPrimaryKey  MigrationOp = "add primary key"
+	OpAlterIndex     MigrationOp = "alter index"
+	OpDropIndex      MigrationOp = "drop index"
+	OpCreateIndex    MigrationOp = "create index"
+	OpAddForeignKey  MigrationOp = "add foreign key"
+	OpAlterTableDesc MigrationOp = "alter table desc"
+)
+
+//SchemaChange is the struct change of the table,the MetaHelper build the statements of it by the BuildDDL.
+//the fields used by the Op:
+//	OpCreateTable:Table
+//	OpDropForeignKey,OpDropColumn,OpDropIndex:Name
+//	OpAlterColumn:OldColumn and Column
+//	OpAddColumn:Column
+//	OpAddPrimaryKey:PK
+//	OpAlterIndex:Name,OldIndex and Index
+//	OpCreateIndex:Name and Index
+//	OpAddForeignKey:ForeignKey
+//	OpAlterTableDesc:Desc
+type SchemaChange struct {
+	Op        MigrationOp
+	TableName string
+	//the column,index or foreign key name,empty if the op is on the table
+	Name       string
+	Table      *DataTable
+	OldColumn  *TableColumn
+	Column     *TableColumn
+	OldIndex   *Index
+	Index      *Index
+	PK         []string
+	ForeignKey *TableForeignKey
+	Desc       DBDesc
+}
+
+//MigrationStep is one operation of the MigrationPlan,SQL is the statements built by the MetaHelper,
+//they are executed by the ExecutePlan
+type MigrationStep struct {
+	Op MigrationOp
+	//the column,index or foreign key name,empty if the op is on the table
+	Name   string
+	SQL    []string
+	change *SchemaChange
+}
+
+//MigrationPlan is the ordered operations to change the table struct,returned by the PlanStruct
+type MigrationPlan struct {
+	TableName string
+	Steps     []*MigrationStep
+}
+
+func newMigrationStep(change *SchemaChange) *MigrationStep {
+	return &MigrationStep{Op: change.Op, Name: change.Name, change: change}
+}
+
+//add the change of the plan table
+func (m *MigrationPlan) add(change *SchemaChange) {
+	change.TableName = m.TableName
+	m.Steps = append(m.Steps, newMigrationStep(change))
+}
+
+//IsEmpty return true if the struct not changed
+func (m *MigrationPlan) IsEmpty() bool {
+	return len(m.Steps) == 0
+}
+
+//String return the sql script of the plan,every step has a comment line
+func (m *MigrationPlan) String() string {
+	lines := []string{}
+	for _, step := range m.Steps {
+		if step.Name != "" {
+			lines = append(lines, fmt.Sprintf("-- %s %s", step.Op, step.Name))
+		} else {
+			lines = append(lines, fmt.Sprintf("-- %s %s", step.Op, m.TableName))
+		}
+		for _, strSql := range step.SQL {
+			lines = append(lines, strSql+";")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+//execute the SQL of the step
+func (s *MigrationStep) execute(h *DBHelper) error {
+	return execStatements(h, s.SQL)
+}
+
+//ddlTransactor is implemented by the MetaHelper that need a special transaction to change the table struct
+type ddlTransactor interface {
+	inDDLTx(tablename string, fn func(h *DBHelper) error) error
+}
+
+//run fn in the transaction of the DDL
+func (p *DBHelper) inDDLTx(tablename string, fn func(h *DBHelper) error) error {
+	if d, ok := p.metaHelper.(ddlTransactor); ok {
+		return d.inDDLTx(tablename, fn)
+	}
+	return p.InTx(fn, nil)
+}
+
+func (p *DBHelper) PlanStructContext(ctx context.Context, oldStruct, newStruct *DataTable, oldColumnsOrder []string) (*MigrationPlan, error) {
+	return p.WithContext(ctx).PlanStruct(oldStruct, newStruct, oldColumnsOrder)
+}
+
+//PlanStruct return the operations to change the table struct from the oldStruct to the newStruct without change the db,
+//nil oldStruct create the table,nil oldColumnsOrder is the columns order of the oldStruct.
+//the SQL of the steps is built by the BuildDDL of the MetaHelper,the statements of a step are built on the struct
+//changed by the previous steps(sqlite rebuild the table),only the queries are executed.
+//the foreign keys of other tables reference the changed primary key are dropped and added around it
+func (p *DBHelper) PlanStruct(oldStruct, newStruct *DataTable, oldColumnsOrder []string) (*MigrationPlan, error) {
+	if len(newStruct.TableName) == 0 {
+		return nil, fmt.Errorf("the table name is empty")
+	}
+	plan, err := planStruct(oldStruct, newStruct, oldColumnsOrder)
+	if err != nil || plan.IsEmpty() {
+		return plan, err
+	}
+	if err = p.planReferencingForeignKeys(plan); err != nil {
+		return nil, err
+	}
+	changes := make([]*SchemaChange, len(plan.Steps))
+	for i, step := range plan.Steps {
+		changes[i] = step.change
+	}
+	stmts, err := p.metaHelper.BuildDDL(changes)
+	if err != nil {
+		return nil, err
+	}
+	for i, step := range plan.Steps {
+		step.SQL = stmts[i]
+	}
+	return plan, nil
+}
+
+//referencingForeignKeyer is implemented by the MetaHelper that the foreign keys must be dropped before the
+//referenced primary key dropped.sqlite rebuild the table with the foreign_keys off,the references are kept
+type referencingForeignKeyer interface {
+	referencingForeignKeys(tablename string) (tables []string, fks []*TableForeignKey, err error)
+}
+
+//the foreign keys of other tables reference the primary key are dropped before the DropPrimaryKey and added
+//after the AddPrimaryKey,error if the new primary key isn't the referenced columns
+func (p *DBHelper) planReferencingForeignKeys(plan *MigrationPlan) error {
+	iDrop, iAdd := -1, -1
+	for i, step := range plan.Steps {
+		switch step.Op {
+		case OpDropPrimaryKey:
+			iDrop = i
+		case OpAddPrimaryKey:
+			iAdd = i
+		}
+	}
+	r, ok := p.metaHelper.(referencingForeignKeyer)
+	if iDrop < 0 || !ok {
+		return nil
+	}
+	tables, fks, err := r.referencingForeignKeys(plan.TableName)
+	if err != nil {
+		return err
+	}
+	//本表的外键已由计划删除
+	dropped := map[string]bool{}
+	for _, step := range plan.Steps[:iDrop] {
+		if step.Op == OpDropForeignKey {
+			dropped[step.Name] = true
+		}
+	}
+	var pk []string
+	if iAdd >= 0 {
+		pk = plan.Steps[iAdd].change.PK
+	}
+	drops, adds, invalid := []*MigrationStep{}, []*MigrationStep{}, []string{}
+	for i, fk := range fks {
+		if tables[i] == plan.TableName && dropped[fk.Name] {
+			continue
+		}
+		if !sameColumnSet(fk.RefColumns, pk) {
+			invalid = append(invalid, fmt.Sprintf("%s.%s(%s)", tables[i], fk.Name, strings.Join(fk.RefColumns, ",")))
+			continue
+		}
+		drops = append(drops, newMigrationStep(&SchemaChange{Op: OpDropForeignKey, TableName: tables[i], Name: fk.Name}))
+		adds = append(adds, newMigrationStep(&SchemaChange{Op: OpAddForeignKey, TableName: tables[i], Name: fk.Name, ForeignKey: fk}))
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("the primary key of the table %s is referenced by the foreign keys %s,the new primary key(%s) can't keep them",
+			plan.TableName, strings.Join(invalid, ","), strings.Join(pk, ","))
+	}
+	if len(drops) == 0 {
+		return nil
+	}
+	steps := append(append([]*MigrationStep{}, plan.Steps[:iDrop]...), drops...)
+	steps = append(steps, plan.Steps[iDrop:iAdd+1]...)
+	steps = append(steps, adds...)
+	plan.Steps = append(steps, plan.Steps[iAdd+1:]...)
+	return nil
+}
+
+//the columns are the same ignore the order
+func sameColumnSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa := append([]string{}, a...)
+	sb := append([]string{}, b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	return reflect.DeepEqual(sa, sb)
+}
+
+//ExecutePlan execute the SQL of the steps(built by the PlanStruct,the MetaHelper isn't called again) in order.
+//if the MetaHelper support the TransactionalDDL,all steps run in one transaction and rollback if failed,else every
+//step is recorded in the MigrationJournalTable,the rerun of the same plan skip the finished steps.
+//the failed step return the *MigrationError
+func (p *DBHelper) ExecutePlan(plan *MigrationPlan) error {
+	if plan.IsEmpty() {
+		return nil
+	}
+	//失败时表结构也可能已部分改变
+	defer p.InvalidateTable(plan.TableName)
+	if transactionalDDL(p.metaHelper) {
+		return p.executePlanInTx(plan)
+	}
+	return p.executePlanJournal(plan)
+}
+func (p *DBHelper) ExecutePlanContext(ctx context.Context, plan *MigrationPlan) error {
+	return p.WithContext(ctx).ExecutePlan(plan)
+}
+
+//the steps of the struct change
+func planStruct(oldStruct, newStruct *DataTable, oldColumnsOrder []string) (*MigrationPlan, error) {
+	tablename := newStruct.TableName
+	plan := &MigrationPlan{TableName: tablename}
+	if oldStruct == nil {
+		table := *newStruct
+		table.Desc = DBDesc{}
+		for k, v := range newStruct.Desc {
+			table.Desc[k] = v
+		}
+		table.Desc["ColumnsOrder"] = oldColumnsOrder
+		plan.add(&SchemaChange{Op: OpCreateTable, Table: &table})
+		return plan, nil
+	}
+	if oldColumnsOrder == nil {
+		oldColumnsOrder = oldStruct.ColumnNames()
+	}
+	colOrders := &columnOrder{append([]string{}, oldColumnsOrder...)}
+
+	//首先判断主关键字是否有变化
+	bKeyChange := false
+	if !reflect.DeepEqual(oldStruct.PK, newStruct.PK) {
+		bKeyChange = true
+	}
+	if !bKeyChange {
+		//判断主键的数据类型是否变化
+		oldPks := oldStruct.PK
+		newPks := newStruct.PK
+		for i := 0; i < len(oldPks); i++ {
+			if oldStruct.Columns[oldStruct.ColumnIndex(oldPks[i])].DataType !=
+				newStruct.Columns[newStruct.ColumnIndex(newPks[i])].DataType ||
+				oldStruct.Columns[oldStruct.ColumnIndex(oldPks[i])].MaxSize !=
+					newStruct.Columns[newStruct.ColumnIndex(newPks[i])].MaxSize ||
+				oldStruct.Columns[oldStruct.ColumnIndex(oldPks[i])].NotNull !=
+					newStruct.Columns[newStruct.ColumnIndex(newPks[i])].NotNull {
+				bKeyChange = true
+				break
+			}
+		}
+	}
+	//找出相对应的一对字段
+	oldColumns := oldStruct.Columns
+	newColumns := []*DataColumn{}
+	for _, v := range newStruct.Columns {
+		newColumns = append(newColumns, v)
+	}
+	type FoundColumn struct {
+		OldColumn *DataColumn
+		NewColumn *DataColumn
+	}
+	foundColumns := []FoundColumn{}
+
+	for _, vNew := range newColumns {
+		trueNewName := vNew.Name
+
+		if vNew.OriginName() != "" && vNew.Name != vNew.OriginName() {
+			trueNewName = vNew.OriginName()
+		}
+		for _, vOld := range oldColumns {
+			if vOld.Name == trueNewName {
+				foundColumns = append(foundColumns, FoundColumn{vOld, vNew})
+			}
+		}
+	}
+	//删除或修改的字段,依赖于它们的外键需要先删除
+	changedColumns := map[string]bool{}
+	for _, oldColumn := range oldColumns {
+		changedColumns[oldColumn.Name] = true
+	}
+	for _, column := range foundColumns {
+		if newTableColumn(column.OldColumn).DefineEqual(newTableColumn(column.NewColumn)) {
+			delete(changedColumns, column.OldColumn.Name)
+		}
+	}
+	//处理外键,删除不存在的、有变化的及依赖于变化的字段、主键(自引用)的外键,最后重新创建
+	keepFks := map[string]bool{}
+	for _, oldFk := range tableForeignKeys(oldStruct) {
+		fkName := oldFk.Name
+		if newFk, ok := newStruct.ForeignKeys[fkName]; ok && newFk.Equal(oldStruct.ForeignKeys[fkName]) {
+			bDepend := bKeyChange && strings.EqualFold(oldFk.RefTable, tablename)
+			for _, c := range oldFk.Columns {
+				if changedColumns[c] {
+					bDepend = true
+					break
+				}
+			}
+			if !bDepend {
+				keepFks[fkName] = true
+				continue
+			}
+		}
+		plan.add(&SchemaChange{Op: OpDropForeignKey, Name: fkName})
+	}
+	if bKeyChange && oldStruct.HasPrimaryKey() {
+		//删除主键
+		plan.add(&SchemaChange{Op: OpDropPrimaryKey})
+	}
+	//删除字段
+	for _, oldColumn := range oldColumns {
+		bFound := false
+		for _, foundColumn := range foundColumns {
+			if oldColumn == foundColumn.OldColumn {
+				bFound = true
+				break
+			}
+		}
+		//找不到的需要删除
+		if !bFound {
+			colName := oldColumn.Name
+			colOrders.delete(colName)
+			plan.add(&SchemaChange{Op: OpDropColumn, Name: colName})
+		}
+	}
+
+	//修改字段类型或者重命名
+	for _, column := range foundColumns {
+		if column.OldColumn.Name != column.NewColumn.Name {
+			colOrders.rename(column.OldColumn.Name, column.NewColumn.Name)
+		}
+		oldCol, newCol := newTableColumn(column.OldColumn), newTableColumn(column.NewColumn)
+		if oldCol.DefineEqual(newCol) && oldCol.storedDesc().Equal(newCol.storedDesc()) {
+			continue
+		}
+		plan.add(&SchemaChange{Op: OpAlterColumn, Name: newCol.Name, OldColumn: oldCol, Column: newCol})
+	}
+	//新增字段
+	for _, newColumn := range newColumns {
+		bFound := false
+		for _, foundColumn := range foundColumns {
+			if newColumn == foundColumn.NewColumn {
+				bFound = true
+				break
+			}
+		}
+		if !bFound {
+			if newColumn.Index() == 0 {
+				colOrders.insert("", newColumn.Name)
+			} else {
+				colOrders.insert(newStruct.Columns[newColumn.Index()-1].Name, newColumn.Name)
+			}
+			col := newTableColumn(newColumn)
+			plan.add(&SchemaChange{Op: OpAddColumn, Name: col.Name, Column: col})
+		}
+	}
+	if bKeyChange && newStruct.HasPrimaryKey() {
+		//创建主键
+		pks := append([]string{}, newStruct.PK...)
+		plan.add(&SchemaChange{Op: OpAddPrimaryKey, PK: pks})
+	}
+	//处理索引,按名称排序,计划的顺序固定
+	//删除不存在的,并修改存在的
+	for _, idxName := range indexNames(oldStruct.Indexes) {
+		idxName, oldIdx := idxName, oldStruct.Indexes[idxName]
+		if newIdx, ok := newStruct.Indexes[idxName]; ok {
+			if !oldIdx.Equal(newIdx) {
+				plan.add(&SchemaChange{Op: OpAlterIndex, Name: idxName, OldIndex: oldIdx, Index: newIdx})
+			}
+		} else {
+			plan.add(&SchemaChange{Op: OpDropIndex, Name: idxName})
+		}
+	}
+	//新增索引
+	for _, idxName := range indexNames(newStruct.Indexes) {
+		idxName, newIdx := idxName, newStruct.Indexes[idxName]
+		if _, ok := oldStruct.Indexes[idxName]; !ok {
+			plan.add(&SchemaChange{Op: OpCreateIndex, Name: idxName, Index: newIdx})
+		}
+	}
+	//新增外键
+	for _, fk := range tableForeignKeys(newStruct) {
+		if keepFks[fk.Name] {
+			continue
+		}
+		plan.add(&SchemaChange{Op: OpAddForeignKey, Name: fk.Name, ForeignKey: fk})
+	}
+	//处理表的描述
+	colOrders.reorder(newStruct.ColumnNames())
+	desc, oldDesc := DBDesc{}, DBDesc{}
+	for k, v := range newStruct.Desc.Clone() {
+		desc[k] = v
+	}
+	for k, v := range oldStruct.Desc.Clone() {
+		oldDesc[k] = v
+	}
+	desc["ColumnsOrder"] = colOrders.colNames
+	oldDesc["ColumnsOrder"] = oldColumnsOrder
+	if !desc.Equal(oldDesc) {
+		plan.add(&SchemaChange{Op: OpAlterTableDesc, Desc: desc})
+	}
+	return plan, nil
+}
+func indexNames(indexes map[string]*Index) []string {
+	rev := []string{}
+	for name := range indexes {
+		rev = append(rev, name)
+	}
+	sort.Strings(rev)
+	return rev
+}
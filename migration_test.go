@@ -0,0 +1,356 @@
+package dbhelper
+
+import (
+	"database/sql/driver"
+	"github.com/linlexing/datatable.go"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//the struct of the orders:drop the memo and the foreign key,add the price,replace the index
+func planStructs() (*DataTable, *DataTable) {
+	oldStruct := NewDataTable("orders")
+	oldStruct.AddColumn(NewDataColumn("id", datatable.Int64, 0, true))
+	oldStruct.AddColumn(NewDataColumn("memo", datatable.String, 0, false))
+	oldStruct.AddIndex("idx_orders_memo", &Index{[]string{"memo"}, false, DBDesc{}})
+	oldStruct.AddForeignKey("fk_orders_customer", &ForeignKey{[]string{"customer_id"}, "customer", []string{"id"}, "", "", DBDesc{}})
+
+	newStruct := NewDataTable("orders")
+	newStruct.AddColumn(NewDataColumn("id", datatable.Int64, 0, true))
+	price := newStruct.AddColumn(NewDataColumn("price", datatable.Float64, 0, true))
+	price.Precision, price.Scale, price.Default = 10, 2, "0"
+	newStruct.AddIndex("idx_orders_price", &Index{[]string{"price"}, false, DBDesc{}})
+	return oldStruct, newStruct
+}
+func Test_planStruct(t *testing.T) {
+	oldStruct, newStruct := planStructs()
+	plan, err := planStruct(oldStruct, newStruct, []string{"id", "memo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []MigrationOp{OpDropForeignKey, OpDropColumn, OpAddColumn, OpDropIndex, OpCreateIndex, OpAlterTableDesc}
+	if len(plan.Steps) != len(expect) {
+		t.Fatalf("got %d steps,expect %v", len(plan.Steps), expect)
+	}
+	for i, step := range plan.Steps {
+		if step.Op != expect[i] {
+			t.Errorf("step %d got %s,expect %s", i, step.Op, expect[i])
+		}
+	}
+
+	for _, order := range [][]string{{"id", "memo"}, nil} {
+		same, err := planStruct(oldStruct, oldStruct, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !same.IsEmpty() || same.String() != "" {
+			t.Errorf("the same struct(order %v) got the steps:\n%s", order, same)
+		}
+	}
+
+	//Generated和SaveChange的选项不是desc,不产生步骤
+	generated := oldStruct.Clone()
+	generated.Columns[0].SetGenerated(true)
+	generated.SetVersionColumn("id")
+	generated.SetPKOnly(true)
+	generated.SetUpdateChangedOnly(true)
+	same, err := planStruct(oldStruct, generated, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same.IsEmpty() {
+		t.Errorf("the generated column got the steps:\n%s", same)
+	}
+}
+func Test_PlanStruct(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeMysqlDriverName)
+	defer h.Close()
+	oldStruct, newStruct := planStructs()
+	plan, err := h.PlanStruct(oldStruct, newStruct, []string{"id", "memo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `-- drop foreign key fk_orders_customer
+ALTER TABLE orders DROP FOREIGN KEY fk_orders_customer;
+-- drop column memo
+ALTER TABLE orders DROP COLUMN memo;
+-- add column price
+ALTER TABLE orders ADD COLUMN price NUMERIC(10,2) DEFAULT 0 NOT NULL;
+-- drop index idx_orders_memo
+DROP INDEX idx_orders_memo ON orders;
+-- create index idx_orders_price
+CREATE INDEX idx_orders_price ON orders(price);
+-- alter table desc orders
+ALTER TABLE orders COMMENT = '{"ColumnsOrder":["id","price"]}';`
+	if s := plan.String(); s != expect {
+		t.Errorf("got:\n%s\nexpect:\n%s", s, expect)
+	}
+	//mysql的DDL不能回滚,只记录不执行
+	if execs := fakeReset(); len(execs) != 0 {
+		t.Errorf("the plan executed %d statements", len(execs))
+	}
+	if plan, err = h.PlanStruct(oldStruct, oldStruct, nil); err != nil || !plan.IsEmpty() {
+		t.Errorf("the same struct got %v,%v", plan, err)
+	}
+}
+
+//the foreign keys of other tables reference the primary key are dropped and added around the primary key change
+func Test_PlanStructReferencingForeignKeys(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeMysqlDriverName)
+	defer h.Close()
+	fakeMutex.Lock()
+	fakeQueryFunc = func(query string, args []driver.Value) (*fakeRows, bool) {
+		if !strings.Contains(query, "k.REFERENCED_TABLE_NAME = ?") {
+			return nil, false
+		}
+		return &fakeRows{[]string{"table", "name", "column", "ref_table", "ref_column", "delete_rule", "update_rule"},
+			[][]driver.Value{{"order_detail", "fk_detail_order", "order_id", "orders", "id", "CASCADE", "NO ACTION"}}}, true
+	}
+	fakeMutex.Unlock()
+	oldStruct := NewDataTable("orders")
+	oldStruct.AddColumn(NewDataColumn("id", datatable.Int64, 0, true))
+	oldStruct.SetPK("id")
+	newStruct := NewDataTable("orders")
+	newStruct.AddColumn(NewDataColumn("id", datatable.String, 20, true))
+	newStruct.SetPK("id")
+	plan, err := h.PlanStruct(oldStruct, newStruct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := []MigrationOp{OpDropForeignKey, OpDropPrimaryKey, OpAlterColumn, OpAddPrimaryKey, OpAddForeignKey}
+	if len(plan.Steps) != len(ops) {
+		t.Fatalf("got the plan:\n%s", plan)
+	}
+	for i, step := range plan.Steps {
+		if step.Op != ops[i] {
+			t.Errorf("step %d got %s,expect %s", i, step.Op, ops[i])
+		}
+	}
+	if s := plan.Steps[0].SQL; !reflect.DeepEqual(s, []string{"ALTER TABLE order_detail DROP FOREIGN KEY fk_detail_order"}) {
+		t.Errorf("got %q", s)
+	}
+	if s := plan.Steps[4].SQL; !reflect.DeepEqual(s, []string{
+		"ALTER TABLE order_detail ADD CONSTRAINT fk_detail_order FOREIGN KEY(order_id) REFERENCES orders(id) ON DELETE CASCADE"}) {
+		t.Errorf("got %q", s)
+	}
+
+	//新主键不是被引用的字段,外键无法保留
+	newStruct = NewDataTable("orders")
+	newStruct.AddColumn(NewDataColumn("id", datatable.Int64, 0, true))
+	newStruct.AddColumn(NewDataColumn("no", datatable.String, 20, true))
+	newStruct.SetPK("id", "no")
+	if _, err = h.PlanStruct(oldStruct, newStruct, nil); err == nil || !strings.Contains(err.Error(), "order_detail.fk_detail_order") {
+		t.Errorf("the unkept foreign key should fail,got %v", err)
+	}
+}
+
+var (
+	fakeSqliteCreateRegexp = regexp.MustCompile(`^CREATE (?:TEMPORARY )?TABLE (IF NOT EXISTS )?(\w+)\(`)
+	fakeSqliteRenameRegexp = regexp.MustCompile(`^ALTER TABLE (\w+) RENAME TO (\w+)$`)
+	fakeSqlitePragmaRegexp = regexp.MustCompile(`^PRAGMA (\w+)\((\w+)\)$`)
+)
+
+//a simulated sqlite db,the tables are changed by the CREATE TABLE,DROP TABLE and ALTER TABLE RENAME,
+//the queries of the sqliteMeta are answered from the CREATE TABLE(the format of the createTableSql)
+type fakeSqliteSchema map[string]string
+
+func newFakeSqliteSchema(tables ...string) fakeSqliteSchema {
+	rev := fakeSqliteSchema{}
+	for _, strSql := range tables {
+		rev.exec(strSql, nil)
+	}
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	fakeExecFunc, fakeQueryFunc = rev.exec, rev.query
+	return rev
+}
+func (f fakeSqliteSchema) exec(query string, args []driver.Value) {
+	if m := fakeSqliteCreateRegexp.FindStringSubmatch(query); m != nil {
+		if _, ok := f[m[2]]; !ok || m[1] == "" {
+			f[m[2]] = query
+		}
+	} else if m := fakeSqliteRenameRegexp.FindStringSubmatch(query); m != nil {
+		f[m[2]] = strings.Replace(f[m[1]], "TABLE "+m[1]+"(", "TABLE "+m[2]+"(", 1)
+		delete(f, m[1])
+	} else if strings.HasPrefix(query, "DROP TABLE ") {
+		delete(f, strings.TrimPrefix(query, "DROP TABLE "))
+	}
+}
+func (f fakeSqliteSchema) query(query string, args []driver.Value) (*fakeRows, bool) {
+	switch query {
+	case "PRAGMA foreign_keys":
+		return &fakeRows{[]string{"foreign_keys"}, [][]driver.Value{{int64(1)}}}, true
+	case "PRAGMA foreign_key_check":
+		return &fakeRows{[]string{"table", "rowid", "parent", "fkid"}, nil}, true
+	case "SELECT name FROM sqlite_master WHERE type='table'":
+		names := []string{}
+		for name := range f {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		rows := [][]driver.Value{}
+		for _, name := range names {
+			rows = append(rows, []driver.Value{name})
+		}
+		return &fakeRows{[]string{"name"}, rows}, true
+	case "SELECT name FROM sqlite_temp_master WHERE type='table' AND name=?":
+		return &fakeRows{[]string{"name"}, nil}, true
+	case "SELECT name FROM sqlite_master WHERE type='table' AND name=?\nUNION ALL\nSELECT name FROM sqlite_temp_master WHERE type='table' AND name=?":
+		if _, ok := f[args[0].(string)]; ok {
+			return &fakeRows{[]string{"name"}, [][]driver.Value{{args[0]}}}, true
+		}
+		return &fakeRows{[]string{"name"}, nil}, true
+	case "SELECT sql FROM sqlite_master WHERE type='table' AND name=?\nUNION ALL\nSELECT sql FROM sqlite_temp_master WHERE type='table' AND name=?":
+		if strSql, ok := f[args[0].(string)]; ok {
+			return &fakeRows{[]string{"sql"}, [][]driver.Value{{strSql}}}, true
+		}
+		return &fakeRows{[]string{"sql"}, nil}, true
+	case "SELECT name,content FROM dbhelper_desc WHERE tablename=? AND kind=?":
+		return &fakeRows{[]string{"name", "content"}, nil}, true
+	}
+	m := fakeSqlitePragmaRegexp.FindStringSubmatch(query)
+	if m == nil {
+		return nil, false
+	}
+	switch m[1] {
+	case "table_xinfo", "table_info":
+		return f.columns(m[2], m[1] == "table_xinfo"), true
+	case "index_list":
+		return &fakeRows{[]string{"seq", "name", "unique", "origin", "partial"}, nil}, true
+	case "foreign_key_list":
+		return &fakeRows{[]string{"id", "seq", "table", "from", "to", "on_update", "on_delete"}, nil}, true
+	}
+	return nil, false
+}
+
+//the columns parsed from the CREATE TABLE,every column or constraint in one line
+func (f fakeSqliteSchema) columns(tablename string, hidden bool) *fakeRows {
+	strSql := f[tablename]
+	body := strSql[strings.Index(strSql, "(")+1 : strings.LastIndex(strSql, ")")]
+	lines := strings.Split(body, ",\n\t")
+	pks := []string{}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "PRIMARY KEY(") {
+			pks = strings.Split(strings.TrimSuffix(strings.TrimPrefix(line, "PRIMARY KEY("), ")"), ",")
+		}
+	}
+	rev := &fakeRows{columns: []string{"cid", "name", "type", "notnull", "dflt_value", "pk", "hidden"}}
+	if !hidden {
+		rev.columns = rev.columns[:6]
+	}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if sqliteConstraintRegexp.MatchString(line) {
+			continue
+		}
+		fields := strings.Fields(line)
+		var dflt driver.Value
+		for i, field := range fields {
+			if field == "DEFAULT" {
+				dflt = fields[i+1]
+			}
+		}
+		pk := int64(0)
+		for i, name := range pks {
+			if name == fields[0] {
+				pk = int64(i + 1)
+			}
+		}
+		notNull := int64(0)
+		if strings.Contains(line, "NOT NULL") {
+			notNull = 1
+		}
+		row := []driver.Value{int64(len(rev.rows)), fields[0], fields[1], notNull, dflt, pk, int64(0)}
+		rev.rows = append(rev.rows, row[:len(rev.columns)])
+	}
+	return rev
+}
+
+func Test_sqlitePlanStruct(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeDriverName)
+	defer h.Close()
+	newFakeSqliteSchema("CREATE TABLE orders(\n\tid TEXT NOT NULL,\n\tmemo TEXT,\n\tqty INTEGER,\n\tPRIMARY KEY(id))")
+	oldStruct := NewDataTable("orders")
+	oldStruct.AddColumn(NewDataColumn("id", datatable.String, 0, true))
+	oldStruct.AddColumn(NewDataColumn("memo", datatable.String, 0, false))
+	oldStruct.AddColumn(NewDataColumn("qty", datatable.Int64, 0, false))
+	oldStruct.SetPK("id")
+	newStruct := NewDataTable("orders")
+	newStruct.AddColumn(NewDataColumn("id", datatable.String, 0, true))
+	newStruct.AddColumn(NewDataColumn("qty", datatable.String, 0, false))
+	price := newStruct.AddColumn(NewDataColumn("price", datatable.Float64, 0, true))
+	price.Precision, price.Scale, price.Default = 10, 2, "0"
+	newStruct.SetPK("id")
+
+	plan, err := h.PlanStruct(oldStruct, newStruct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//每一步的重建都基于前一步修改后的表
+	expect := [][]string{
+		{"CREATE TABLE orders_dbhelper_rebuild(\n\tid TEXT NOT NULL,\n\tqty INTEGER,\n\tPRIMARY KEY(id))",
+			"INSERT INTO orders_dbhelper_rebuild(id,qty)\nSELECT id,qty FROM orders"},
+		{"CREATE TABLE orders_dbhelper_rebuild(\n\tid TEXT NOT NULL,\n\tqty TEXT,\n\tPRIMARY KEY(id))",
+			"INSERT INTO orders_dbhelper_rebuild(id,qty)\nSELECT id,qty FROM orders"},
+		{"CREATE TABLE orders_dbhelper_rebuild(\n\tid TEXT NOT NULL,\n\tqty TEXT,\n\tprice NUMERIC(10,2) NOT NULL DEFAULT 0,\n\tPRIMARY KEY(id))",
+			"INSERT INTO orders_dbhelper_rebuild(id,qty)\nSELECT id,qty FROM orders"},
+	}
+	ops := []MigrationOp{OpDropColumn, OpAlterColumn, OpAddColumn, OpAlterTableDesc}
+	if len(plan.Steps) != len(ops) {
+		t.Fatalf("got the plan:\n%s", plan)
+	}
+	for i, step := range plan.Steps {
+		if step.Op != ops[i] {
+			t.Errorf("step %d got %s,expect %s", i, step.Op, ops[i])
+		}
+		if i < len(expect) && (len(step.SQL) < 4 || !reflect.DeepEqual(step.SQL[:2], expect[i]) ||
+			step.SQL[2] != "DROP TABLE orders" || step.SQL[3] != "ALTER TABLE orders_dbhelper_rebuild RENAME TO orders") {
+			t.Errorf("step %d got %q,expect %q", i, step.SQL, expect[i])
+		}
+	}
+	desc := plan.Steps[3].SQL
+	if expect := []string{sqliteDescTableSql,
+		"INSERT INTO dbhelper_desc(tablename,kind,name,content)VALUES('orders','table','','{\"ColumnsOrder\":[\"id\",\"qty\",\"price\"]}')",
+	}; !reflect.DeepEqual(desc, expect) {
+		t.Errorf("got %q,expect %q", desc, expect)
+	}
+	//只查询,不执行语句,不开启事务
+	if sqls, _ := fakeStatements(fakeDrain()); len(sqls) != 0 {
+		t.Errorf("the plan executed %q", sqls)
+	}
+	if log := fakeTxLog(); len(log) != 0 {
+		t.Errorf("got %v", log)
+	}
+
+	//执行计划中记录的语句,不再读取表结构
+	fakeReset()
+	fakeResult("PRAGMA foreign_keys", []string{"foreign_keys"}, []driver.Value{int64(1)})
+	fakeResult("PRAGMA foreign_key_check", []string{"table", "rowid", "parent", "fkid"})
+	if err = h.ExecutePlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	log := fakeTxLog()
+	sqls, _ := fakeStatements(fakeReset())
+	planSqls := []string{"PRAGMA foreign_keys=OFF"}
+	for _, step := range plan.Steps {
+		for _, strSql := range step.SQL {
+			planSqls = append(planSqls, strings.Join(strings.Fields(strSql), " "))
+		}
+	}
+	planSqls = append(planSqls, "PRAGMA foreign_keys=ON")
+	if !reflect.DeepEqual(sqls, planSqls) {
+		t.Errorf("got %q,expect %q", sqls, planSqls)
+	}
+	if !reflect.DeepEqual(log, []string{"BEGIN", "COMMIT"}) {
+		t.Errorf("got %v", log)
+	}
+}
@@ -0,0 +1,791 @@
+package dbhelper
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/linlexing/datatable.go"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type mysqlMeta struct {
+	RootMeta
+	standardSavepoint
+}
+
+func init() {
+	registerBuiltinMetaHelper("mysql", &mysqlMeta{})
+}
+
+//return a copy of the meta bind to the h
+func (m *mysqlMeta) Bind(h *DBHelper) MetaHelper {
+	rev := *m
+	rev.DBHelper = h
+	return &rev
+}
+
+func mysqlDBType(dataType datatable.ColumnType, maxSize int) (string, error) {
+	switch dataType {
+	case datatable.String:
+		if maxSize > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", maxSize), nil
+		}
+		return "LONGTEXT", nil
+	case datatable.Int64:
+		return "BIGINT", nil
+	case datatable.Float64:
+		return "DOUBLE", nil
+	case datatable.Time:
+		return "DATETIME", nil
+	case datatable.Bool:
+		return "BOOLEAN", nil
+	default:
+		return "", fmt.Errorf("the column type %v not support by mysql", dataType)
+	}
+}
+
+//parse the information_schema.COLUMNS's DATA_TYPE and COLUMN_TYPE,return the column type
+func mysqlParseType(dataType, columnType string) datatable.ColumnType {
+	switch strings.ToLower(dataType) {
+	case "tinyint":
+		//BOOLEAN是tinyint(1)的别名
+		if strings.HasPrefix(strings.ToLower(columnType), "tinyint(1)") {
+			return datatable.Bool
+		}
+		return datatable.Int64
+	case "bit":
+		if strings.ToLower(columnType) == "bit(1)" {
+			return datatable.Bool
+		}
+		return datatable.Int64
+	case "smallint", "mediumint", "int", "integer", "bigint", "year":
+		return datatable.Int64
+	case "float", "double", "decimal", "numeric":
+		return datatable.Float64
+	case "date", "datetime", "timestamp", "time":
+		return datatable.Time
+	default:
+		return datatable.String
+	}
+}
+
+//split the table name to the schema condition and the table name
+func mysqlSplitName(tablename string) (string, []interface{}) {
+	if i := strings.LastIndex(tablename, "."); i > -1 {
+		return "TABLE_SCHEMA = {{ph}} AND TABLE_NAME = {{ph}}", []interface{}{tablename[:i], tablename[i+1:]}
+	}
+	return "TABLE_SCHEMA = DATABASE() AND TABLE_NAME = {{ph}}", []interface{}{tablename}
+}
+//the condition of mysqlSplitName with the table alias
+func mysqlSplitNameAlias(tablename, alias string) (string, []interface{}) {
+	where, args := mysqlSplitName(tablename)
+	where = strings.Replace(where, "TABLE_SCHEMA", alias+".TABLE_SCHEMA", 1)
+	return strings.Replace(where, "TABLE_NAME", alias+".TABLE_NAME", 1), args
+}
+func mysqlParseDesc(comment string) (DBDesc, error) {
+	rev := DBDesc{}
+	if err := rev.Parse(comment); err != nil {
+		return nil, fmt.Errorf("the comment %q isn't a valid desc:%s", comment, err)
+	}
+	return rev, nil
+}
+func (m *mysqlMeta) StringExpress(value string) string {
+	return "'" + strings.Replace(strings.Replace(value, `\`, `\\`, -1), "'", "''", -1) + "'"
+}
+func (m *mysqlMeta) ParamPlaceholder(num int) string {
+	return "?"
+}
+func (m *mysqlMeta) RegLike(value, strRegexp string) string {
+	return fmt.Sprintf("%s REGEXP %s", value, strRegexp)
+}
+func (m *mysqlMeta) StringCat(values ...string) string {
+	return fmt.Sprintf("CONCAT(%s)", strings.Join(values, ","))
+}
+func (m *mysqlMeta) TableExists(tablename string) (bool, error) {
+	where, args := mysqlSplitName(tablename)
+	return m.DBHelper.Exists("SELECT 1 FROM information_schema.TABLES WHERE "+where, args...)
+}
+func (m *mysqlMeta) GetColumns(tablename string) ([]*TableColumn, error) {
+	//在打开rows之前查询,事务中同一连接不能同时有两个结果集
+	checks, err := m.columnChecks(tablename)
+	if err != nil {
+		return nil, err
+	}
+	quoted, err := m.quotedDefault()
+	if err != nil {
+		return nil, err
+	}
+	where, args := mysqlSplitName(tablename)
+	rows, err := m.DBHelper.Query(`
+SELECT
+	COLUMN_NAME,
+	DATA_TYPE,
+	COLUMN_TYPE,
+	CHARACTER_MAXIMUM_LENGTH,
+	IS_NULLABLE,
+	COLUMN_COMMENT,
+	COLUMN_DEFAULT,
+	GENERATION_EXPRESSION,
+	EXTRA
+FROM
+	information_schema.COLUMNS
+WHERE
+	`+where+`
+ORDER BY
+	ORDINAL_POSITION`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rev := []*TableColumn{}
+	for rows.Next() {
+		var name, dataType, columnType, nullable, comment, extra string
+		var maxLength sql.NullInt64
+		var defValue, genExpr sql.NullString
+		if err := rows.Scan(&name, &dataType, &columnType, &maxLength, &nullable, &comment, &defValue, &genExpr, &extra); err != nil {
+			return nil, err
+		}
+		colType := mysqlParseType(dataType, columnType)
+		maxSize := 0
+		//只有varchar、char需要长度,text类型视为不限长度
+		if colType == datatable.String && maxLength.Valid &&
+			(strings.EqualFold(dataType, "varchar") || strings.EqualFold(dataType, "char")) {
+			maxSize = int(maxLength.Int64)
+		}
+		desc, err := mysqlParseDesc(comment)
+		if err != nil {
+			return nil, err
+		}
+		col := &TableColumn{Name: name, Type: colType, MaxSize: maxSize, NotNull: nullable == "NO", Desc: desc,
+			Check: checks[strings.ToLower(checkName(tablename, name))]}
+		if colType == datatable.Float64 {
+			col.Precision, col.Scale, _ = parseNumericType(columnType)
+		}
+		extra = strings.ToUpper(extra)
+		if strings.Contains(extra, "GENERATED") && !strings.Contains(extra, "DEFAULT_GENERATED") {
+			col.Computed = genExpr.String
+		} else {
+			col.Default = m.columnDefault(defValue, extra, colType, quoted)
+		}
+		if strings.Contains(extra, "AUTO_INCREMENT") {
+			col.Desc[DescGenerated] = true
+		}
+		rev = append(rev, col)
+	}
+	return rev, rows.Err()
+}
+
+//the mariadb 10.2.7+ return the quoted string default and the NULL default as the expression
+func (m *mysqlMeta) quotedDefault() (bool, error) {
+	var version string
+	if err := m.DBHelper.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		return false, err
+	}
+	return mysqlQuotedDefault(version), nil
+}
+func mysqlQuotedDefault(version string) bool {
+	if !strings.Contains(strings.ToLower(version), "mariadb") {
+		return false
+	}
+	var major, minor, patch int
+	fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch)
+	return major > 10 || major == 10 && (minor > 2 || minor == 2 && patch >= 7)
+}
+
+//the CURRENT_TIMESTAMP and the synonyms
+var mysqlTimestampRegexp = regexp.MustCompile(`(?i)^(current_timestamp|now|localtime|localtimestamp)(\(\d*\))?$`)
+
+//convert the COLUMN_DEFAULT to the sql expression,quoted is the result of the quotedDefault
+func (m *mysqlMeta) columnDefault(defValue sql.NullString, extra string, colType datatable.ColumnType, quoted bool) string {
+	if !defValue.Valid {
+		return ""
+	}
+	value := defValue.String
+	if quoted {
+		if strings.EqualFold(value, "NULL") {
+			return ""
+		}
+	} else {
+		switch {
+		//mysql 8的表达式缺省值,除CURRENT_TIMESTAMP外需要括号
+		case strings.Contains(extra, "DEFAULT_GENERATED"):
+			if !mysqlTimestampRegexp.MatchString(value) && !strings.HasPrefix(value, "(") {
+				value = "(" + value + ")"
+			}
+		//mysql 5.7没有DEFAULT_GENERATED,时间列的CURRENT_TIMESTAMP是函数
+		case mysqlTimestampRegexp.MatchString(value):
+		//常量缺省值没有引号
+		case colType == datatable.Int64, colType == datatable.Float64, colType == datatable.Bool:
+		default:
+			value = m.StringExpress(value)
+		}
+	}
+	//mariadb返回current_timestamp()
+	if strings.EqualFold(value, "current_timestamp()") {
+		value = "CURRENT_TIMESTAMP"
+	}
+	return value
+}
+
+//the check constraints of the table(mysql 8.0.16+),the key is the lower name,value is the expression,
+//the server before mysql 8.0.16/mariadb 10.2.22 has no CHECK_CONSTRAINTS view,return no checks
+func (m *mysqlMeta) columnChecks(tablename string) (map[string]string, error) {
+	where, args := mysqlSplitNameAlias(tablename, "t")
+	rows, err := m.DBHelper.Query(`
+SELECT
+	c.CONSTRAINT_NAME,
+	c.CHECK_CLAUSE
+FROM
+	information_schema.TABLE_CONSTRAINTS t
+	JOIN information_schema.CHECK_CONSTRAINTS c ON
+		c.CONSTRAINT_SCHEMA = t.CONSTRAINT_SCHEMA AND
+		c.CONSTRAINT_NAME = t.CONSTRAINT_NAME
+WHERE
+	`+where+` AND
+	t.CONSTRAINT_TYPE = 'CHECK'`, args...)
+	if err != nil {
+		//Error 1109: Unknown table 'CHECK_CONSTRAINTS' in information_schema
+		if match := mysqlErrorNumber.FindStringSubmatch(err.Error()); match != nil && match[1] == "1109" {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	rev := map[string]string{}
+	for rows.Next() {
+		var name, clause string
+		if err := rows.Scan(&name, &clause); err != nil {
+			return nil, err
+		}
+		expr := strings.TrimSpace(strings.Replace(clause, "`", "", -1))
+		if strings.HasPrefix(expr, "(") && matchedParen(expr, 0) == len(expr)-1 {
+			expr = expr[1 : len(expr)-1]
+		}
+		rev[strings.ToLower(name)] = expr
+	}
+	return rev, rows.Err()
+}
+func (m *mysqlMeta) GetPrimaryKeys(tablename string) ([]string, error) {
+	where, args := mysqlSplitName(tablename)
+	rows, err := m.DBHelper.Query(`
+SELECT
+	COLUMN_NAME
+FROM
+	information_schema.STATISTICS
+WHERE
+	`+where+` AND
+	INDEX_NAME = 'PRIMARY'
+ORDER BY
+	SEQ_IN_INDEX`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rev := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		rev = append(rev, name)
+	}
+	return rev, rows.Err()
+}
+func (m *mysqlMeta) GetIndexes(tablename string) ([]*TableIndex, error) {
+	where, args := mysqlSplitName(tablename)
+	rows, err := m.DBHelper.Query(`
+SELECT
+	INDEX_NAME,
+	NON_UNIQUE,
+	COLUMN_NAME,
+	INDEX_COMMENT
+FROM
+	information_schema.STATISTICS
+WHERE
+	`+where+` AND
+	INDEX_NAME <> 'PRIMARY'
+ORDER BY
+	INDEX_NAME,
+	SEQ_IN_INDEX`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rev := []*TableIndex{}
+	var last *TableIndex
+	for rows.Next() {
+		var name, colName, comment string
+		var nonUnique int64
+		if err := rows.Scan(&name, &nonUnique, &colName, &comment); err != nil {
+			return nil, err
+		}
+		if last == nil || last.Name != name {
+			desc, err := mysqlParseDesc(comment)
+			if err != nil {
+				return nil, err
+			}
+			last = &TableIndex{name, nil, nonUnique == 0, desc}
+			rev = append(rev, last)
+		}
+		last.Columns = append(last.Columns, colName)
+	}
+	return rev, rows.Err()
+}
+func (m *mysqlMeta) GetForeignKeys(tablename string) ([]*TableForeignKey, error) {
+	where, args := mysqlSplitNameAlias(tablename, "k")
+	_, fks, err := m.foreignKeys(where, args)
+	return fks, err
+}
+
+//the foreign keys of the tables(include self) reference the table,tables is the table of every foreign key
+func (m *mysqlMeta) referencingForeignKeys(tablename string) (tables []string, fks []*TableForeignKey, err error) {
+	where, args := mysqlSplitNameAlias(tablename, "k")
+	return m.foreignKeys(strings.Replace(where, "k.TABLE_", "k.REFERENCED_TABLE_", -1), args)
+}
+
+//the foreign keys match the where of the KEY_COLUMN_USAGE k,the table is qualified by the schema if not the current
+func (m *mysqlMeta) foreignKeys(where string, args []interface{}) ([]string, []*TableForeignKey, error) {
+	rows, err := m.DBHelper.Query(`
+SELECT
+	IF(k.TABLE_SCHEMA = DATABASE(), k.TABLE_NAME, CONCAT(k.TABLE_SCHEMA, '.', k.TABLE_NAME)),
+	k.CONSTRAINT_NAME,
+	k.COLUMN_NAME,
+	k.REFERENCED_TABLE_NAME,
+	k.REFERENCED_COLUMN_NAME,
+	r.DELETE_RULE,
+	r.UPDATE_RULE
+FROM
+	information_schema.KEY_COLUMN_USAGE k
+	JOIN information_schema.REFERENTIAL_CONSTRAINTS r ON
+		r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND
+		r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+WHERE
+	`+where+` AND
+	k.REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY
+	k.TABLE_SCHEMA,
+	k.TABLE_NAME,
+	k.CONSTRAINT_NAME,
+	k.ORDINAL_POSITION`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	tables := []string{}
+	rev := []*TableForeignKey{}
+	var last *TableForeignKey
+	for rows.Next() {
+		var table, name, colName, refTable, refColName, delRule, updRule string
+		if err := rows.Scan(&table, &name, &colName, &refTable, &refColName, &delRule, &updRule); err != nil {
+			return nil, nil, err
+		}
+		if last == nil || last.Name != name || tables[len(tables)-1] != table {
+			tables = append(tables, table)
+			last = &TableForeignKey{
+				Name:     name,
+				RefTable: refTable,
+				OnDelete: foreignKeyAction(delRule),
+				OnUpdate: foreignKeyAction(updRule),
+				Desc:     DBDesc{},
+			}
+			rev = append(rev, last)
+		}
+		last.Columns = append(last.Columns, colName)
+		last.RefColumns = append(last.RefColumns, refColName)
+	}
+	return tables, rev, rows.Err()
+}
+//mysql has no comment of the constraint,the Desc of the foreign key isn't saved
+func (m *mysqlMeta) AddForeignKey(tablename string, fk *TableForeignKey) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpAddForeignKey, TableName: tablename, Name: fk.Name, ForeignKey: fk})
+}
+func (m *mysqlMeta) DropForeignKey(tablename, fkname string) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpDropForeignKey, TableName: tablename, Name: fkname})
+}
+func (m *mysqlMeta) GetTableDesc(tablename string) (DBDesc, error) {
+	where, args := mysqlSplitName(tablename)
+	var comment string
+	if err := m.DBHelper.QueryRow("SELECT TABLE_COMMENT FROM information_schema.TABLES WHERE "+where, args...).Scan(&comment); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("the table %q not found", tablename)
+		}
+		return nil, err
+	}
+	return mysqlParseDesc(comment)
+}
+func (m *mysqlMeta) descExpress(desc DBDesc) string {
+	if desc.IsEmpty() {
+		return "''"
+	}
+	return m.StringExpress(desc.String())
+}
+func (m *mysqlMeta) AlterTableDesc(tablename string, desc DBDesc) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpAlterTableDesc, TableName: tablename, Desc: desc})
+}
+
+//the full column define,include the comment
+func (m *mysqlMeta) columnDefine(column *TableColumn) (string, error) {
+	dbType, err := columnDBType(column, mysqlDBType)
+	if err != nil {
+		return "", err
+	}
+	rev := column.Name + " " + dbType
+	if column.Computed != "" {
+		rev += fmt.Sprintf(" GENERATED ALWAYS AS (%s) STORED", column.Computed)
+	} else if column.Default != "" {
+		rev += " DEFAULT " + column.Default
+	}
+	if column.NotNull {
+		rev += " NOT NULL"
+	} else {
+		rev += " NULL"
+	}
+	if column.Generated() && column.Type == datatable.Int64 && column.Computed == "" && column.Default == "" {
+		rev += " AUTO_INCREMENT"
+	}
+	if desc := column.storedDesc(); !desc.IsEmpty() {
+		rev += " COMMENT " + m.descExpress(desc)
+	}
+	return rev, nil
+}
+func (m *mysqlMeta) indexDefine(indexName string, columns []string, unique bool, desc DBDesc) string {
+	strUnique := ""
+	if unique {
+		strUnique = "UNIQUE "
+	}
+	rev := fmt.Sprintf("%sINDEX %s(%s)", strUnique, indexName, strings.Join(columns, ","))
+	if !desc.IsEmpty() {
+		rev += " COMMENT " + m.descExpress(desc)
+	}
+	return rev
+}
+func (m *mysqlMeta) createTableSql(table *DataTable) (string, error) {
+	lines := []string{}
+	for _, col := range tableColumns(table) {
+		line, err := m.columnDefine(col)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	if table.HasPrimaryKey() {
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY(%s)", strings.Join(table.PK, ",")))
+	}
+	for _, col := range tableColumns(table) {
+		if col.Check != "" {
+			lines = append(lines, fmt.Sprintf("CONSTRAINT %s CHECK (%s)", checkName(table.TableName, col.Name), col.Check))
+		}
+	}
+	for _, idx := range tableIndexes(table) {
+		lines = append(lines, m.indexDefine(idx.Name, idx.Columns, idx.Unique, idx.Desc))
+	}
+	for _, fk := range tableForeignKeys(table) {
+		lines = append(lines, fmt.Sprintf("CONSTRAINT %s %s", fk.Name, foreignKeyClause(fk)))
+	}
+	strTemp := ""
+	if table.Temporary {
+		strTemp = "TEMPORARY "
+	}
+	strSql := fmt.Sprintf("CREATE %sTABLE %s(\n\t%s)", strTemp, table.TableName, strings.Join(lines, ",\n\t"))
+	if !table.Desc.IsEmpty() {
+		strSql += " COMMENT = " + m.descExpress(table.Desc)
+	}
+	return strSql, nil
+}
+func (m *mysqlMeta) CreateTable(table *DataTable) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpCreateTable, TableName: table.TableName, Table: table})
+}
+func (m *mysqlMeta) DropPrimaryKey(tablename string) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpDropPrimaryKey, TableName: tablename})
+}
+func (m *mysqlMeta) AddPrimaryKey(tablename string, pks []string) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpAddPrimaryKey, TableName: tablename, PK: pks})
+}
+func (m *mysqlMeta) AddColumn(tablename string, column *TableColumn) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpAddColumn, TableName: tablename, Name: column.Name, Column: column})
+}
+func (m *mysqlMeta) addColumnSql(tablename string, column *TableColumn) (string, error) {
+	define, err := m.columnDefine(column)
+	if err != nil {
+		return "", err
+	}
+	strSql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", tablename, define)
+	if column.Check != "" {
+		strSql += fmt.Sprintf(", ADD CONSTRAINT %s CHECK (%s)", checkName(tablename, column.Name), column.Check)
+	}
+	return strSql, nil
+}
+func (m *mysqlMeta) AlterColumn(tablename string, oldColumn, newColumn *TableColumn) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpAlterColumn, TableName: tablename, Name: newColumn.Name,
+		OldColumn: oldColumn, Column: newColumn})
+}
+func (m *mysqlMeta) alterColumnSql(tablename string, oldColumn, newColumn *TableColumn) ([]string, error) {
+	if oldColumn.DefineEqual(newColumn) && oldColumn.storedDesc().Equal(newColumn.storedDesc()) {
+		return nil, nil
+	}
+	//CHANGE COLUMN会去掉未声明的AUTO_INCREMENT,没有明确声明Generated时保留
+	if _, ok := newColumn.Desc[DescGenerated]; !ok && oldColumn.Generated() {
+		col := *newColumn
+		col.Desc = DBDesc{}
+		for k, v := range newColumn.Desc {
+			col.Desc[k] = v
+		}
+		col.Desc[DescGenerated] = true
+		newColumn = &col
+	}
+	define, err := m.columnDefine(newColumn)
+	if err != nil {
+		return nil, err
+	}
+	rev := []string{}
+	//check约束按字段名命名,改名时需要重建
+	checkChanged := oldColumn.Name != newColumn.Name || !sqlExprEqual(oldColumn.Check, newColumn.Check)
+	if checkChanged && oldColumn.Check != "" {
+		rev = append(rev, fmt.Sprintf("ALTER TABLE %s DROP CHECK %s", tablename, checkName(tablename, oldColumn.Name)))
+	}
+	rev = append(rev, fmt.Sprintf("ALTER TABLE %s CHANGE COLUMN %s %s", tablename, oldColumn.Name, define))
+	if checkChanged && newColumn.Check != "" {
+		rev = append(rev, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)",
+			tablename, checkName(tablename, newColumn.Name), newColumn.Check))
+	}
+	return rev, nil
+}
+func (m *mysqlMeta) CreateIndex(tableName, indexName string, columns []string, unique bool, desc DBDesc) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpCreateIndex, TableName: tableName, Name: indexName,
+		Index: &Index{columns, unique, desc}})
+}
+func (m *mysqlMeta) DropIndex(tablename, indexname string) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpDropIndex, TableName: tablename, Name: indexname})
+}
+
+//mysql can't alter the index comment,so drop and create the index
+func (m *mysqlMeta) AlterIndex(tablename, indexname string, oldIndex, newIndex *Index) error {
+	return execDDL(m.DBHelper, m, &SchemaChange{Op: OpAlterIndex, TableName: tablename, Name: indexname,
+		OldIndex: oldIndex, Index: newIndex})
+}
+
+//the DDL of the mysql is independent of the struct,every change is built alone
+func (m *mysqlMeta) BuildDDL(changes []*SchemaChange) ([][]string, error) {
+	rev := make([][]string, len(changes))
+	for i, c := range changes {
+		var strSql string
+		var err error
+		switch c.Op {
+		case OpCreateTable:
+			strSql, err = m.createTableSql(c.Table)
+		case OpDropForeignKey:
+			strSql = fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", c.TableName, c.Name)
+		case OpDropPrimaryKey:
+			strSql = fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY", c.TableName)
+		case OpDropColumn:
+			strSql = dropColumnSql(c.TableName, c.Name)
+		case OpAlterColumn:
+			if rev[i], err = m.alterColumnSql(c.TableName, c.OldColumn, c.Column); err != nil {
+				return nil, err
+			}
+			continue
+		case OpAddColumn:
+			strSql, err = m.addColumnSql(c.TableName, c.Column)
+		case OpAddPrimaryKey:
+			strSql = addPrimaryKeySql(c.TableName, c.PK)
+		case OpAlterIndex:
+			strSql = fmt.Sprintf("ALTER TABLE %s DROP INDEX %s, ADD %s",
+				c.TableName, c.Name, m.indexDefine(c.Name, c.Index.Columns, c.Index.Unique, c.Index.Desc))
+		case OpDropIndex:
+			strSql = fmt.Sprintf("DROP INDEX %s ON %s", c.Name, c.TableName)
+		case OpCreateIndex:
+			strUnique := ""
+			if c.Index.Unique {
+				strUnique = "UNIQUE "
+			}
+			strSql = fmt.Sprintf("CREATE %sINDEX %s ON %s(%s)", strUnique, c.Name, c.TableName, strings.Join(c.Index.Columns, ","))
+			if !c.Index.Desc.IsEmpty() {
+				strSql += " COMMENT " + m.descExpress(c.Index.Desc)
+			}
+		case OpAddForeignKey:
+			strSql = fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", c.TableName, c.ForeignKey.Name, foreignKeyClause(c.ForeignKey))
+		case OpAlterTableDesc:
+			strSql = fmt.Sprintf("ALTER TABLE %s COMMENT = %s", c.TableName, m.descExpress(c.Desc))
+		default:
+			return nil, fmt.Errorf("the op %q not support by mysql", c.Op)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rev[i] = []string{strSql}
+	}
+	return rev, nil
+}
+
+//the ON DUPLICATE KEY UPDATE clause,autoUpdate update the columns not in the primary key
+func mysqlDuplicateClause(colNames, pkColumns []string, autoUpdate bool) string {
+	sets := []string{}
+	if autoUpdate {
+		for _, col := range nonKeyColumns(colNames, pkColumns) {
+			sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", col, col))
+		}
+	}
+	if len(sets) == 0 {
+		//不更新时,对主键自身赋值,避免insert ignore忽略其他错误
+		sets = append(sets, fmt.Sprintf("%s = %s", pkColumns[0], pkColumns[0]))
+	}
+	return "ON DUPLICATE KEY UPDATE\n\t" + strings.Join(sets, ",\n\t")
+}
+
+//merge the source rows into dest,sqlWhere filter the source rows.
+//autoRemove will delete the dest rows that not in the source
+func (m *mysqlMeta) Merge(dest, source string, colNames []string, pkColumns []string, autoUpdate, autoRemove bool, sqlWhere string) error {
+	if len(pkColumns) == 0 {
+		return fmt.Errorf("the merge primary key is empty")
+	}
+	if sqlWhere == "" {
+		sqlWhere = "1=1"
+	}
+	strInsert := fmt.Sprintf("INSERT INTO %s(%s)\nSELECT %s FROM %s src WHERE %s\n%s",
+		dest, strings.Join(colNames, ","), strings.Join(colNames, ","), source, sqlWhere, mysqlDuplicateClause(colNames, pkColumns, autoUpdate))
+	return m.inTrans(func(m *mysqlMeta) error {
+		if autoRemove {
+			joins := make([]string, len(pkColumns))
+			for i, pk := range pkColumns {
+				joins[i] = fmt.Sprintf("src.%s = %s.%s", pk, dest, pk)
+			}
+			if _, err := m.DBHelper.Exec(fmt.Sprintf("DELETE FROM %s WHERE NOT EXISTS(\n\tSELECT 1 FROM %s src WHERE %s AND (%s))",
+				dest, source, strings.Join(joins, " AND "), sqlWhere)); err != nil {
+				return err
+			}
+		}
+		_, err := m.DBHelper.Exec(strInsert)
+		return err
+	})
+}
+//the DDL of the mysql commit the transaction implicitly
+func (m *mysqlMeta) TransactionalDDL() bool {
+	return false
+}
+func (m *mysqlMeta) MaxParams() int {
+	return 65535
+}
+func (m *mysqlMeta) NullSafeEqual(column, placeholder string) string {
+	return fmt.Sprintf("%s <=> %s", column, placeholder)
+}
+func (m *mysqlMeta) BuildUpsertSql(tablename string, cols, pkColumns []string) string {
+	return fmt.Sprintf("INSERT INTO %s(%s)VALUES(%s)\n%s",
+		tablename, strings.Join(cols, ","), valuesPlaceholder(len(cols)), mysqlDuplicateClause(cols, pkColumns, true))
+}
+
+//the error of the go-sql-driver/mysql is "Error 1062 (23000): Duplicate entry..."
+var mysqlErrorNumber = regexp.MustCompile(`Error (\d+)`)
+
+func (m *mysqlMeta) ClassifyError(err error) ErrorKind {
+	match := mysqlErrorNumber.FindStringSubmatch(err.Error())
+	if match == nil {
+		return ErrorUnknown
+	}
+	switch match[1] {
+	case "1062", "1586":
+		return ErrorUniqueViolation
+	case "1451", "1452", "1216", "1217":
+		return ErrorForeignKeyViolation
+	case "1048", "1364":
+		return ErrorNotNullViolation
+	case "3819":
+		return ErrorCheckViolation
+	case "1213":
+		return ErrorDeadlock
+	case "1205":
+		return ErrorLockTimeout
+	}
+	return ErrorUnknown
+}
+
+//MysqlRegisterReaderHandler and MysqlDeregisterReaderHandler must be set to the mysql.RegisterReaderHandler and
+//the mysql.DeregisterReaderHandler of the github.com/go-sql-driver/mysql,the BulkLoad register the reader of the
+//LOAD DATA LOCAL INFILE 'Reader::<name>' by them,the batched INSERT is used if not set
+var (
+	MysqlRegisterReaderHandler   func(name string, handler func() io.Reader)
+	MysqlDeregisterReaderHandler func(name string)
+)
+
+//the sequence of the reader name
+var mysqlReaderSeq int64
+
+//BulkLoad load the rows by the LOAD DATA LOCAL INFILE,the rows are streamed to the reader.
+//return the ErrBulkLoadUnsupported if the reader handler functions not set
+func (m *mysqlMeta) BulkLoad(ctx context.Context, tablename string, cols []string, rows [][]interface{}) (int64, error) {
+	if MysqlRegisterReaderHandler == nil || MysqlDeregisterReaderHandler == nil {
+		return 0, ErrBulkLoadUnsupported
+	}
+	name := fmt.Sprintf("dbhelper_%d", atomic.AddInt64(&mysqlReaderSeq, 1))
+	MysqlRegisterReaderHandler(name, func() io.Reader {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(mysqlWriteLoadData(pw, rows))
+		}()
+		return pr
+	})
+	defer MysqlDeregisterReaderHandler(name)
+	result, err := m.DBHelper.ExecContext(ctx, mysqlLoadDataSql(name, tablename, cols))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+func mysqlLoadDataSql(reader, tablename string, cols []string) string {
+	return fmt.Sprintf("LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s CHARACTER SET utf8mb4\n"+
+		"FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (%s)", reader, tablename, strings.Join(cols, ","))
+}
+
+var mysqlLoadDataEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`)
+
+//write the rows in the default format of the LOAD DATA,the NULL is \N
+func mysqlWriteLoadData(w io.Writer, rows [][]interface{}) error {
+	buf := bufio.NewWriter(w)
+	for _, r := range rows {
+		for i, v := range r {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			if valuer, ok := v.(driver.Valuer); ok {
+				var err error
+				if v, err = valuer.Value(); err != nil {
+					return err
+				}
+			}
+			switch tv := v.(type) {
+			case nil:
+				buf.WriteString(`\N`)
+			case string:
+				mysqlLoadDataEscaper.WriteString(buf, tv)
+			case []byte:
+				mysqlLoadDataEscaper.WriteString(buf, string(tv))
+			case time.Time:
+				buf.WriteString(tv.Format("2006-01-02 15:04:05.999999"))
+			case bool:
+				if tv {
+					buf.WriteByte('1')
+				} else {
+					buf.WriteByte('0')
+				}
+			default:
+				mysqlLoadDataEscaper.WriteString(buf, fmt.Sprint(tv))
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Flush()
+}
+
+//run fn in a transaction,the mysqlMeta passed to fn is bind to the transaction
+func (m *mysqlMeta) inTrans(fn func(m *mysqlMeta) error) error {
+	return m.RootMeta.inTrans(func(h *DBHelper) error {
+		tm := *m
+		tm.DBHelper = h
+		return fn(&tm)
+	})
+}
@@ -0,0 +1,118 @@
+package dbhelper
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/linlexing/datatable.go"
+	"strings"
+	"testing"
+)
+
+func Test_mysqlParseType(t *testing.T) {
+	cases := []struct {
+		dataType   string
+		columnType string
+		colType    datatable.ColumnType
+	}{
+		{"varchar", "varchar(20)", datatable.String},
+		{"longtext", "longtext", datatable.String},
+		{"tinyint", "tinyint(1)", datatable.Bool},
+		{"tinyint", "tinyint(4)", datatable.Int64},
+		{"bigint", "bigint(20)", datatable.Int64},
+		{"decimal", "decimal(10,2)", datatable.Float64},
+		{"datetime", "datetime", datatable.Time},
+	}
+	for _, c := range cases {
+		if colType := mysqlParseType(c.dataType, c.columnType); colType != c.colType {
+			t.Errorf("%q parse to %v,expect %v", c.columnType, colType, c.colType)
+		}
+	}
+}
+func Test_mysqlStringExpress(t *testing.T) {
+	m := &mysqlMeta{}
+	if str := m.StringExpress(`it's a\b`); str != `'it''s a\\b'` {
+		t.Errorf("got %s", str)
+	}
+}
+func Test_mysqlColumnDefault(t *testing.T) {
+	m := &mysqlMeta{}
+	cases := []struct {
+		value   interface{}
+		extra   string
+		colType datatable.ColumnType
+		quoted  bool
+		expect  string
+	}{
+		{nil, "", datatable.String, false, ""},
+		{"abc", "", datatable.String, false, "'abc'"},
+		{"0", "", datatable.Int64, false, "0"},
+		{"CURRENT_TIMESTAMP", "DEFAULT_GENERATED", datatable.Time, false, "CURRENT_TIMESTAMP"},
+		{"uuid()", "DEFAULT_GENERATED", datatable.String, false, "(uuid())"},
+		//mysql 5.7
+		{"CURRENT_TIMESTAMP", "", datatable.Time, false, "CURRENT_TIMESTAMP"},
+		{"CURRENT_TIMESTAMP(3)", "on update CURRENT_TIMESTAMP(3)", datatable.Time, false, "CURRENT_TIMESTAMP(3)"},
+		//mariadb 10.2.7+
+		{"'abc'", "", datatable.String, true, "'abc'"},
+		{"NULL", "", datatable.String, true, ""},
+		{"current_timestamp()", "", datatable.Time, true, "CURRENT_TIMESTAMP"},
+		{"0", "", datatable.Int64, true, "0"},
+	}
+	for _, c := range cases {
+		var def sql.NullString
+		def.Scan(c.value)
+		if got := m.columnDefault(def, strings.ToUpper(c.extra), c.colType, c.quoted); got != c.expect {
+			t.Errorf("%v(%s) got %q,expect %q", c.value, c.extra, got, c.expect)
+		}
+	}
+	for version, expect := range map[string]bool{
+		"8.0.32":                     false,
+		"5.7.40-log":                 false,
+		"10.1.48-MariaDB":            false,
+		"10.2.7-MariaDB":             true,
+		"10.6.12-MariaDB-0ubuntu0.2": true,
+	} {
+		if got := mysqlQuotedDefault(version); got != expect {
+			t.Errorf("%s got %v,expect %v", version, got, expect)
+		}
+	}
+}
+func Test_mysqlColumnDefine(t *testing.T) {
+	m := &mysqlMeta{}
+	col := &TableColumn{Name: "id", Type: datatable.Int64, NotNull: true, Desc: DBDesc{DescGenerated: true, "a": 1}}
+	define, err := m.columnDefine(col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "id BIGINT NOT NULL AUTO_INCREMENT COMMENT '{\"a\":1}'"; define != expect {
+		t.Errorf("got %s,expect %s", define, expect)
+	}
+}
+func Test_mysqlCreateIndex(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeMysqlDriverName)
+	defer h.Close()
+	if err := h.metaHelper.CreateIndex("orders", "idx_orders_price", []string{"price", "id"}, true, DBDesc{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	sqls, _ := fakeStatements(fakeReset())
+	if expect := "CREATE UNIQUE INDEX idx_orders_price ON orders(price,id) COMMENT '{\"a\":1}'"; len(sqls) != 1 || sqls[0] != expect {
+		t.Errorf("got %q,expect %q", sqls, expect)
+	}
+}
+func Test_mysqlColumnChecksUnsupported(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeMysqlDriverName)
+	defer h.Close()
+	m := h.metaHelper.(*mysqlMeta)
+	//mysql 5.7没有CHECK_CONSTRAINTS视图
+	fakeFail("CHECK_CONSTRAINTS", errors.New("Error 1109: Unknown table 'CHECK_CONSTRAINTS' in information_schema"))
+	if checks, err := m.columnChecks("orders"); err != nil || len(checks) != 0 {
+		t.Errorf("got %v,%v", checks, err)
+	}
+	fakeFail("CHECK_CONSTRAINTS", errors.New("Error 1142: SELECT command denied"))
+	if _, err := m.columnChecks("orders"); err == nil {
+		t.Error("expect the error")
+	}
+}
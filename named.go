@@ -0,0 +1,205 @@
+package dbhelper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+//the field of the struct mapped to the column
+type structField struct {
+	Name  string
+	Index []int
+	//the db tag has the omitempty option,the zero value is omitted by the Insert,Update and Upsert
+	OmitEmpty bool
+}
+
+//reflect.Type --> []*structField
+var structFieldsCache sync.Map
+
+//the fields of the struct,cached by the type.used by the named params,the struct scan and the crud
+func structFields(t reflect.Type) []*structField {
+	if v, ok := structFieldsCache.Load(t); ok {
+		return v.([]*structField)
+	}
+	v, _ := structFieldsCache.LoadOrStore(t, parseStructFields(t))
+	return v.([]*structField)
+}
+
+//the column name is the db tag or the field name,the options follow the name with comma(db:"name,omitempty"),
+//the field tagged db:"-" is ignored,the embedded struct's fields are flattened
+func parseStructFields(t reflect.Type) []*structField {
+	rev := []*structField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for _, sub := range parseStructFields(ft) {
+					sub.Index = append([]int{i}, sub.Index...)
+					rev = append(rev, sub)
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		omitEmpty := false
+		if tag != "" {
+			opts := strings.Split(tag, ",")
+			if opts[0] != "" {
+				name = opts[0]
+			}
+			for _, opt := range opts[1:] {
+				if strings.TrimSpace(opt) == "omitempty" {
+					omitEmpty = true
+				}
+			}
+		}
+		rev = append(rev, &structField{name, f.Index, omitEmpty})
+	}
+	return rev
+}
+
+//NamedParams convert the map or the struct to the param map of the sql template,
+//the struct field use the db tag as the name
+func NamedParams(params interface{}) (map[string]interface{}, error) {
+	if params == nil {
+		return map[string]interface{}{}, nil
+	}
+	if m, ok := params.(map[string]interface{}); ok {
+		return m, nil
+	}
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, fmt.Errorf("the params is nil")
+		}
+		v = v.Elem()
+	}
+	rev := map[string]interface{}{}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("the params %T key isn't string", params)
+		}
+		for _, k := range v.MapKeys() {
+			rev[k.String()] = v.MapIndex(k).Interface()
+		}
+	case reflect.Struct:
+		for _, f := range structFields(v.Type()) {
+			fv, ok := fieldByIndex(v, f.Index)
+			if !ok {
+				rev[f.Name] = nil
+				continue
+			}
+			rev[f.Name] = fv.Interface()
+		}
+	default:
+		return nil, fmt.Errorf("the params %T must be map or struct", params)
+	}
+	return rev, nil
+}
+
+//the names of the omitempty fields with the zero value,nil if the params isn't a struct
+func omittedParams(params interface{}) map[string]bool {
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	rev := map[string]bool{}
+	for _, f := range structFields(v.Type()) {
+		if !f.OmitEmpty {
+			continue
+		}
+		if fv, ok := fieldByIndex(v, f.Index); !ok || fv.IsZero() {
+			rev[f.Name] = true
+		}
+	}
+	return rev
+}
+
+//the field value,return false if through a nil embedded pointer
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+func (h *DBHelper) QueryNamed(query string, params interface{}) (*sql.Rows, error) {
+	return h.QueryNamedContext(h.context(), query, params)
+}
+
+//QueryNamedContext query the sql with the named params,params is map or struct,
+//the sql template use {{param "name"}} as the placeholder
+func (h *DBHelper) QueryNamedContext(ctx context.Context, query string, params interface{}) (*sql.Rows, error) {
+	m, err := NamedParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return h.QueryTContext(ctx, query, m)
+}
+func (h *DBHelper) QueryRowNamed(query string, params interface{}) *Row {
+	return h.QueryRowNamedContext(h.context(), query, params)
+}
+func (h *DBHelper) QueryRowNamedContext(ctx context.Context, query string, params interface{}) *Row {
+	m, err := NamedParams(params)
+	if err != nil {
+		return &Row{err: err}
+	}
+	return h.QueryRowTContext(ctx, query, m)
+}
+func (h *DBHelper) QueryOneNamed(query string, params interface{}) (interface{}, error) {
+	return h.QueryOneNamedContext(h.context(), query, params)
+}
+func (h *DBHelper) QueryOneNamedContext(ctx context.Context, query string, params interface{}) (interface{}, error) {
+	m, err := NamedParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return h.QueryOneTContext(ctx, query, m)
+}
+func (h *DBHelper) ExecNamed(query string, params interface{}) (sql.Result, error) {
+	return h.ExecNamedContext(h.context(), query, params)
+}
+func (h *DBHelper) ExecNamedContext(ctx context.Context, query string, params interface{}) (sql.Result, error) {
+	m, err := NamedParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return h.ExecTContext(ctx, query, m)
+}
+func (h *DBHelper) GetDataNamed(query string, params interface{}) (*DataTable, error) {
+	return h.GetDataNamedContext(h.context(), query, params)
+}
+func (h *DBHelper) GetDataNamedContext(ctx context.Context, query string, params interface{}) (*DataTable, error) {
+	m, err := NamedParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return h.GetDataTContext(ctx, query, m)
+}
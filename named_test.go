@@ -0,0 +1,52 @@
+package dbhelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ConvertSqlArgs(t *testing.T) {
+	h := NewDBHelper("postgres", "")
+	strSql := `select * from t where a={{ph}}{{if .b}} and b={{param "b"}}{{end}} and c={{ph}} and (d={{param "id"}} or e={{param "id"}})`
+	rev, args, err := h.ConvertSqlArgs(strSql, map[string]interface{}{"b": "x", "id": 3}, 1, 2, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != "select * from t where a=$1 and b=$2 and c=$3 and (d=$4 or e=$5)" {
+		t.Errorf("got %q", rev)
+	}
+	if !reflect.DeepEqual(args, []interface{}{1, "x", 2, 3, 3, 9}) {
+		t.Errorf("got %#v", args)
+	}
+	if _, args, _ = h.ConvertSqlArgs("select ?", nil, 1); !reflect.DeepEqual(args, []interface{}{1}) {
+		t.Errorf("the args should be unchanged without named param,got %#v", args)
+	}
+	if _, _, err = h.ConvertSqlArgs(`select {{param "none"}}`, nil); err == nil {
+		t.Error("param not found error expected")
+	}
+	if _, err = h.ConvertSql(`select {{param "b"}}`, map[string]interface{}{"b": 1}); err == nil {
+		t.Error("ConvertSql should reject the named param")
+	}
+}
+func Test_NamedParams(t *testing.T) {
+	type Base struct {
+		ID int64 `db:"id"`
+	}
+	type User struct {
+		Base
+		Name    string `db:"user_name"`
+		Age     int
+		Ignored string `db:"-"`
+		secret  string
+	}
+	m, err := NamedParams(&User{Base{7}, "tom", 20, "x", "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"id": int64(7), "user_name": "tom", "Age": 20}) {
+		t.Errorf("got %#v", m)
+	}
+	if _, err = NamedParams(1); err == nil {
+		t.Error("error expected")
+	}
+}
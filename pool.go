@@ -0,0 +1,104 @@
+package dbhelper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+//Options is the options of the connection pool,the zero value is the default of the database/sql
+type Options struct {
+	//<= 0 is unlimited
+	MaxOpenConns int
+	//0 is the default(2),< 0 not keep the idle connection
+	MaxIdleConns int
+	//<= 0 the connection is reused forever
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	//ping the db when Open,and retry PingRetries times if fail,
+	//the wait before the first retry is PingRetryDelay(default 100ms),doubled every retry
+	Ping           bool
+	PingRetries    int
+	PingRetryDelay time.Duration
+}
+
+func (o *Options) apply(db *sql.DB) {
+	if o.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime != 0 {
+		db.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+	if o.ConnMaxIdleTime != 0 {
+		db.SetConnMaxIdleTime(o.ConnMaxIdleTime)
+	}
+}
+func (o *Options) ping(ctx context.Context, db *sql.DB) error {
+	delay := o.PingRetryDelay
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	for i := 0; ; i++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if i >= o.PingRetries {
+			return fmt.Errorf("ping the db fail after %d times:%v", i+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+//LivenessChecker is implemented by the MetaHelper that has the query to check the db is alive,
+//the RootMeta implement it by SELECT 1
+type LivenessChecker interface {
+	LivenessSql() string
+}
+
+//HealthStatus is the result of the HealthCheck
+type HealthStatus struct {
+	Stats sql.DBStats
+	//the time of the ping and the liveness query
+	Latency time.Duration
+}
+
+//Stats return the statistics of the connection pool,zero if the db not open
+func (h *DBHelper) Stats() sql.DBStats {
+	if h.db == nil {
+		return sql.DBStats{}
+	}
+	return h.db.Stats()
+}
+
+//HealthCheck ping the db and run the liveness query of the MetaHelper,
+//the status is returned even if the check fail
+func (h *DBHelper) HealthCheck(ctx context.Context) (HealthStatus, error) {
+	if h.db == nil {
+		return HealthStatus{}, ErrNotOpen
+	}
+	begin := time.Now()
+	err := h.db.PingContext(ctx)
+	if err == nil {
+		if lc, ok := h.metaHelper.(LivenessChecker); ok {
+			strSql := lc.LivenessSql()
+			var v interface{}
+			if err = h.db.QueryRowContext(ctx, strSql).Scan(&v); err != nil {
+				err = h.sqlError(strSql, err)
+			}
+		}
+	}
+	return HealthStatus{
+		Stats:   h.db.Stats(),
+		Latency: time.Since(begin),
+	}, err
+}
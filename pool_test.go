@@ -0,0 +1,34 @@
+package dbhelper
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+func Test_HealthCheck(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := NewDBHelper(fakeDriverName, "", &Options{MaxOpenConns: 3, Ping: true})
+	if _, err := h.HealthCheck(context.Background()); err == nil {
+		t.Error("health check of the db not open should fail")
+	}
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if h.Stats().MaxOpenConnections != 3 {
+		t.Errorf("the max open conns %d,expect 3", h.Stats().MaxOpenConnections)
+	}
+	if _, err := h.HealthCheck(context.Background()); err == nil {
+		t.Error("the liveness query should fail")
+	}
+	fakeResult("SELECT 1", []string{"1"}, []driver.Value{int64(1)})
+	status, err := h.HealthCheck(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Stats.MaxOpenConnections != 3 {
+		t.Errorf("the status stats %#v", status.Stats)
+	}
+}
@@ -0,0 +1,738 @@
+package dbhelper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/linlexing/datatable.go"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	pgTypeRegexp = regexp.MustCompile(`^\s*([^(]*?)\s*(?:\(\s*(\d+)\s*(?:,\s*\d+\s*)?\))?\s*(?:\[\])?\s*$`)
+)
+
+type postgresMeta struct {
+	RootMeta
+	standardSavepoint
+}
+
+func init() {
+	registerBuiltinMetaHelper("postgres", &postgresMeta{})
+}
+
+//return a copy of the meta bind to the h
+func (p *postgresMeta) Bind(h *DBHelper) MetaHelper {
+	rev := *p
+	rev.DBHelper = h
+	return &rev
+}
+
+func pgDBType(dataType datatable.ColumnType, maxSize int) (string, error) {
+	switch dataType {
+	case datatable.String:
+		if maxSize > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", maxSize), nil
+		}
+		return "TEXT", nil
+	case datatable.Int64:
+		return "BIGINT", nil
+	case datatable.Float64:
+		return "DOUBLE PRECISION", nil
+	case datatable.Time:
+		return "TIMESTAMP", nil
+	case datatable.Bool:
+		return "BOOLEAN", nil
+	default:
+		return "", fmt.Errorf("the column type %v not support by postgres", dataType)
+	}
+}
+
+//parse the result of format_type(),return the column type and max size
+func pgParseType(dbType string) (datatable.ColumnType, int) {
+	typeName := strings.ToLower(dbType)
+	maxSize := 0
+	if m := pgTypeRegexp.FindStringSubmatch(typeName); m != nil {
+		typeName = m[1]
+		if m[2] != "" {
+			maxSize, _ = strconv.Atoi(m[2])
+		}
+	}
+	switch {
+	case typeName == "boolean":
+		return datatable.Bool, 0
+	case strings.HasPrefix(typeName, "timestamp"), strings.HasPrefix(typeName, "time"), typeName == "date":
+		return datatable.Time, 0
+	case typeName == "bigint", typeName == "integer", typeName == "smallint":
+		return datatable.Int64, 0
+	case typeName == "double precision", typeName == "real", typeName == "numeric":
+		return datatable.Float64, 0
+	case typeName == "character varying", typeName == "character":
+		return datatable.String, maxSize
+	default:
+		return datatable.String, 0
+	}
+}
+
+//the pg_constraint.confdeltype,confupdtype
+var pgForeignKeyActions = map[string]string{
+	"a": "",
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
+//the schema prefix of the table name,index name must in the same schema
+func pgSchemaPrefix(tablename string) string {
+	if i := strings.LastIndex(tablename, "."); i > -1 {
+		return tablename[:i+1]
+	}
+	return ""
+}
+
+//the comment of the desc,empty desc return NULL
+func (p *postgresMeta) descExpress(desc DBDesc) string {
+	if desc.IsEmpty() {
+		return "NULL"
+	}
+	return p.StringExpress(desc.String())
+}
+func pgParseDesc(comment sql.NullString) (DBDesc, error) {
+	rev := DBDesc{}
+	if comment.Valid {
+		if err := rev.Parse(comment.String); err != nil {
+			return nil, fmt.Errorf("the comment %q isn't a valid desc:%s", comment.String, err)
+		}
+	}
+	return rev, nil
+}
+func (p *postgresMeta) StringExpress(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+func (p *postgresMeta) ParamPlaceholder(num int) string {
+	return fmt.Sprintf("$%d", num)
+}
+func (p *postgresMeta) RegLike(value, strRegexp string) string {
+	return fmt.Sprintf("%s ~ %s", value, strRegexp)
+}
+func (p *postgresMeta) StringCat(values ...string) string {
+	return strings.Join(values, " || ")
+}
+func (p *postgresMeta) TableExists(tablename string) (bool, error) {
+	return p.DBHelper.Exists(
+		"SELECT 1 FROM pg_catalog.pg_class WHERE oid = to_regclass({{ph}}) AND relkind IN ('r','p')", tablename)
+}
+func (p *postgresMeta) GetColumns(tablename string) ([]*TableColumn, error) {
+	rows, err := p.DBHelper.Query(`
+SELECT
+	a.attname,
+	pg_catalog.format_type(a.atttypid, a.atttypmod),
+	a.attnotnull,
+	pg_catalog.col_description(a.attrelid, a.attnum),
+	pg_catalog.pg_get_expr(d.adbin, d.adrelid),
+	a.attgenerated = 's',
+	a.attidentity <> '',
+	(SELECT pg_catalog.pg_get_constraintdef(c.oid) FROM pg_catalog.pg_constraint c
+		WHERE c.conrelid = a.attrelid AND c.contype = 'c' AND c.conkey = ARRAY[a.attnum] LIMIT 1)
+FROM
+	pg_catalog.pg_attribute a
+	LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE
+	a.attrelid = {{ph}}::regclass AND
+	a.attnum > 0 AND
+	NOT a.attisdropped
+ORDER BY
+	a.attnum`, tablename)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rev := []*TableColumn{}
+	for rows.Next() {
+		var name, dbType string
+		var notNull, computed, identity bool
+		var comment, expr, check sql.NullString
+		if err := rows.Scan(&name, &dbType, &notNull, &comment, &expr, &computed, &identity, &check); err != nil {
+			return nil, err
+		}
+		colType, maxSize := pgParseType(dbType)
+		desc, err := pgParseDesc(comment)
+		if err != nil {
+			return nil, err
+		}
+		col := &TableColumn{Name: name, Type: colType, MaxSize: maxSize, NotNull: notNull, Desc: desc}
+		if colType == datatable.Float64 {
+			col.Precision, col.Scale, _ = parseNumericType(dbType)
+		}
+		//生成列的表达式也保存在pg_attrdef中
+		if computed {
+			col.Computed = expr.String
+		} else {
+			col.Default = expr.String
+		}
+		if check.Valid {
+			col.Check = pgCheckExpr(check.String)
+		}
+		//identity和serial列
+		if identity || strings.HasPrefix(col.Default, "nextval(") {
+			col.Desc[DescGenerated] = true
+		}
+		rev = append(rev, col)
+	}
+	return rev, rows.Err()
+}
+func (p *postgresMeta) GetPrimaryKeys(tablename string) ([]string, error) {
+	rows, err := p.DBHelper.Query(`
+SELECT
+	a.attname
+FROM
+	pg_catalog.pg_index i
+	CROSS JOIN LATERAL unnest(i.indkey::smallint[]) WITH ORDINALITY AS k(attnum, ord)
+	JOIN pg_catalog.pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+WHERE
+	i.indrelid = {{ph}}::regclass AND
+	i.indisprimary
+ORDER BY
+	k.ord`, tablename)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rev := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		rev = append(rev, name)
+	}
+	return rev, rows.Err()
+}
+func (p *postgresMeta) GetIndexes(tablename string) ([]*TableIndex, error) {
+	//表达式索引的字段attnum为0,关联不到字段,自动忽略
+	rows, err := p.DBHelper.Query(`
+SELECT
+	c.relname,
+	i.indisunique,
+	a.attname,
+	pg_catalog.obj_description(c.oid, 'pg_class')
+FROM
+	pg_catalog.pg_index i
+	JOIN pg_catalog.pg_class c ON c.oid = i.indexrelid
+	CROSS JOIN LATERAL unnest(i.indkey::smallint[]) WITH ORDINALITY AS k(attnum, ord)
+	JOIN pg_catalog.pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+WHERE
+	i.indrelid = {{ph}}::regclass AND
+	NOT i.indisprimary
+ORDER BY
+	c.relname,
+	k.ord`, tablename)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rev := []*TableIndex{}
+	var last *TableIndex
+	for rows.Next() {
+		var name, colName string
+		var unique bool
+		var comment sql.NullString
+		if err := rows.Scan(&name, &unique, &colName, &comment); err != nil {
+			return nil, err
+		}
+		if last == nil || last.Name != name {
+			desc, err := pgParseDesc(comment)
+			if err != nil {
+				return nil, err
+			}
+			last = &TableIndex{name, nil, unique, desc}
+			rev = append(rev, last)
+		}
+		last.Columns = append(last.Columns, colName)
+	}
+	return rev, rows.Err()
+}
+func (p *postgresMeta) GetForeignKeys(tablename string) ([]*TableForeignKey, error) {
+	_, fks, err := p.foreignKeys("c.conrelid", tablename)
+	return fks, err
+}
+
+//the foreign keys of the tables(include self) reference the table,tables is the table of every foreign key
+func (p *postgresMeta) referencingForeignKeys(tablename string) (tables []string, fks []*TableForeignKey, err error) {
+	return p.foreignKeys("c.confrelid", tablename)
+}
+
+//the foreign keys that the relid column(conrelid or confrelid) is the table
+func (p *postgresMeta) foreignKeys(relid, tablename string) ([]string, []*TableForeignKey, error) {
+	rows, err := p.DBHelper.Query(`
+SELECT
+	c.conrelid::regclass::text,
+	c.conname,
+	a.attname,
+	c.confrelid::regclass::text,
+	ra.attname,
+	c.confdeltype,
+	c.confupdtype,
+	pg_catalog.obj_description(c.oid, 'pg_constraint')
+FROM
+	pg_catalog.pg_constraint c
+	CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, refnum, ord)
+	JOIN pg_catalog.pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+	JOIN pg_catalog.pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = k.refnum
+WHERE
+	`+relid+` = {{ph}}::regclass AND
+	c.contype = 'f'
+ORDER BY
+	c.conrelid,
+	c.conname,
+	k.ord`, tablename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	tables := []string{}
+	rev := []*TableForeignKey{}
+	var last *TableForeignKey
+	for rows.Next() {
+		var table, name, colName, refTable, refColName, delType, updType string
+		var comment sql.NullString
+		if err := rows.Scan(&table, &name, &colName, &refTable, &refColName, &delType, &updType, &comment); err != nil {
+			return nil, nil, err
+		}
+		if last == nil || last.Name != name || tables[len(tables)-1] != table {
+			desc, err := pgParseDesc(comment)
+			if err != nil {
+				return nil, nil, err
+			}
+			tables = append(tables, table)
+			last = &TableForeignKey{
+				Name:     name,
+				RefTable: refTable,
+				OnDelete: pgForeignKeyActions[delType],
+				OnUpdate: pgForeignKeyActions[updType],
+				Desc:     desc,
+			}
+			rev = append(rev, last)
+		}
+		last.Columns = append(last.Columns, colName)
+		last.RefColumns = append(last.RefColumns, refColName)
+	}
+	return tables, rev, rows.Err()
+}
+func (p *postgresMeta) AddForeignKey(tablename string, fk *TableForeignKey) error {
+	return p.execDDL(&SchemaChange{Op: OpAddForeignKey, TableName: tablename, Name: fk.Name, ForeignKey: fk})
+}
+func (p *postgresMeta) addForeignKeySql(tablename string, fk *TableForeignKey) []string {
+	rev := []string{fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", tablename, fk.Name, foreignKeyClause(fk))}
+	if !fk.Desc.IsEmpty() {
+		rev = append(rev, fmt.Sprintf("COMMENT ON CONSTRAINT %s ON %s IS %s", fk.Name, tablename, p.descExpress(fk.Desc)))
+	}
+	return rev
+}
+func (p *postgresMeta) DropForeignKey(tablename, fkname string) error {
+	return p.execDDL(&SchemaChange{Op: OpDropForeignKey, TableName: tablename, Name: fkname})
+}
+func (p *postgresMeta) GetTableDesc(tablename string) (DBDesc, error) {
+	var comment sql.NullString
+	if err := p.DBHelper.QueryRow("SELECT pg_catalog.obj_description({{ph}}::regclass, 'pg_class')", tablename).Scan(&comment); err != nil {
+		return nil, err
+	}
+	return pgParseDesc(comment)
+}
+func (p *postgresMeta) AlterTableDesc(tablename string, desc DBDesc) error {
+	return p.execDDL(&SchemaChange{Op: OpAlterTableDesc, TableName: tablename, Desc: desc})
+}
+func (p *postgresMeta) alterColumnDescSql(tablename, column string, desc DBDesc) string {
+	return fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s", tablename, column, p.descExpress(desc))
+}
+func (p *postgresMeta) alterIndexDescSql(tablename, indexname string, desc DBDesc) string {
+	return fmt.Sprintf("COMMENT ON INDEX %s%s IS %s", pgSchemaPrefix(tablename), indexname, p.descExpress(desc))
+}
+//the expression of the pg_get_constraintdef,CHECK ((expr))
+func pgCheckExpr(def string) string {
+	expr := strings.TrimSpace(strings.TrimPrefix(def, "CHECK "))
+	if strings.HasPrefix(expr, "(") && matchedParen(expr, 0) == len(expr)-1 {
+		expr = expr[1 : len(expr)-1]
+	}
+	return expr
+}
+func (p *postgresMeta) columnDefine(tablename string, column *TableColumn) (string, error) {
+	dbType, err := columnDBType(column, pgDBType)
+	if err != nil {
+		return "", err
+	}
+	rev := column.Name + " " + dbType
+	if column.Computed != "" {
+		rev += fmt.Sprintf(" GENERATED ALWAYS AS (%s) STORED", column.Computed)
+	} else if column.Default != "" {
+		rev += " DEFAULT " + column.Default
+	} else if column.Generated() && column.Type == datatable.Int64 {
+		rev += " GENERATED BY DEFAULT AS IDENTITY"
+	}
+	if column.NotNull {
+		rev += " NOT NULL"
+	}
+	if column.Check != "" {
+		rev += fmt.Sprintf(" CONSTRAINT %s CHECK (%s)", checkName(tablename, column.Name), column.Check)
+	}
+	return rev, nil
+}
+
+//the statements drop the check constraints of the column,the constraints are queried by the column name
+func (p *postgresMeta) dropColumnCheckSql(tablename, column string) ([]string, error) {
+	rows, err := p.DBHelper.Query(`
+SELECT
+	c.conname
+FROM
+	pg_catalog.pg_constraint c
+	JOIN pg_catalog.pg_attribute a ON a.attrelid = c.conrelid AND c.conkey = ARRAY[a.attnum]
+WHERE
+	c.conrelid = {{ph}}::regclass AND
+	c.contype = 'c' AND
+	a.attname = {{ph}}`, tablename, column)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rev := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		rev = append(rev, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", tablename, name))
+	}
+	return rev, rows.Err()
+}
+func (p *postgresMeta) createTableSql(table *DataTable) ([]string, error) {
+	columns := tableColumns(table)
+	lines := []string{}
+	for _, col := range columns {
+		line, err := p.columnDefine(table.TableName, col)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	if table.HasPrimaryKey() {
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY(%s)", strings.Join(table.PK, ",")))
+	}
+	strTemp := ""
+	if table.Temporary {
+		strTemp = "TEMPORARY "
+	}
+	rev := []string{fmt.Sprintf("CREATE %sTABLE %s(\n\t%s)", strTemp, table.TableName, strings.Join(lines, ",\n\t"))}
+	for _, col := range columns {
+		if desc := col.storedDesc(); !desc.IsEmpty() {
+			rev = append(rev, p.alterColumnDescSql(table.TableName, col.Name, desc))
+		}
+	}
+	for _, idx := range tableIndexes(table) {
+		rev = append(rev, p.createIndexSql(table.TableName, idx.Name, idx.Columns, idx.Unique, idx.Desc)...)
+	}
+	for _, fk := range tableForeignKeys(table) {
+		rev = append(rev, p.addForeignKeySql(table.TableName, fk)...)
+	}
+	if !table.Desc.IsEmpty() {
+		rev = append(rev, fmt.Sprintf("COMMENT ON TABLE %s IS %s", table.TableName, p.descExpress(table.Desc)))
+	}
+	return rev, nil
+}
+func (p *postgresMeta) CreateTable(table *DataTable) error {
+	return p.execDDL(&SchemaChange{Op: OpCreateTable, TableName: table.TableName, Table: table})
+}
+func (p *postgresMeta) DropPrimaryKey(tablename string) error {
+	return p.execDDL(&SchemaChange{Op: OpDropPrimaryKey, TableName: tablename})
+}
+
+//the name of the primary key constraint is queried
+func (p *postgresMeta) dropPrimaryKeySql(tablename string) (string, error) {
+	var name string
+	if err := p.DBHelper.QueryRow(
+		"SELECT conname FROM pg_catalog.pg_constraint WHERE conrelid = {{ph}}::regclass AND contype = 'p'", tablename).Scan(&name); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("the table %q primary key not found", tablename)
+		}
+		return "", err
+	}
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", tablename, name), nil
+}
+func (p *postgresMeta) AddPrimaryKey(tablename string, pks []string) error {
+	return p.execDDL(&SchemaChange{Op: OpAddPrimaryKey, TableName: tablename, PK: pks})
+}
+func (p *postgresMeta) AddColumn(tablename string, column *TableColumn) error {
+	return p.execDDL(&SchemaChange{Op: OpAddColumn, TableName: tablename, Name: column.Name, Column: column})
+}
+func (p *postgresMeta) addColumnSql(tablename string, column *TableColumn) ([]string, error) {
+	define, err := p.columnDefine(tablename, column)
+	if err != nil {
+		return nil, err
+	}
+	rev := []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", tablename, define)}
+	if desc := column.storedDesc(); !desc.IsEmpty() {
+		rev = append(rev, p.alterColumnDescSql(tablename, column.Name, desc))
+	}
+	return rev, nil
+}
+func (p *postgresMeta) AlterColumn(tablename string, oldColumn, newColumn *TableColumn) error {
+	return p.execDDL(&SchemaChange{Op: OpAlterColumn, TableName: tablename, Name: newColumn.Name,
+		OldColumn: oldColumn, Column: newColumn})
+}
+func (p *postgresMeta) alterColumnSql(tablename string, oldColumn, newColumn *TableColumn) ([]string, error) {
+	rev := []string{}
+	if oldColumn.Name != newColumn.Name {
+		rev = append(rev, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", tablename, oldColumn.Name, newColumn.Name))
+	}
+	if !sqlExprEqual(oldColumn.Computed, newColumn.Computed) {
+		if newColumn.Computed == "" {
+			//保留已计算的值
+			rev = append(rev, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP EXPRESSION", tablename, newColumn.Name))
+		} else {
+			//计算列的表达式不能修改,删除后重建
+			add, err := p.addColumnSql(tablename, newColumn)
+			if err != nil {
+				return nil, err
+			}
+			return append(append(rev, dropColumnSql(tablename, newColumn.Name)), add...), nil
+		}
+	}
+	if oldColumn.Type != newColumn.Type || oldColumn.MaxSize != newColumn.MaxSize ||
+		oldColumn.Precision != newColumn.Precision || oldColumn.Scale != newColumn.Scale {
+		dbType, err := columnDBType(newColumn, pgDBType)
+		if err != nil {
+			return nil, err
+		}
+		rev = append(rev, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s",
+			tablename, newColumn.Name, dbType, newColumn.Name, dbType))
+	}
+	//serial的缺省值是nextval,声明为Generated且没有缺省值时保留
+	if newColumn.Computed == "" && !sqlExprEqual(oldColumn.Default, newColumn.Default) &&
+		!(newColumn.Generated() && newColumn.Default == "") {
+		strAction := "DROP DEFAULT"
+		if newColumn.Default != "" {
+			strAction = "SET DEFAULT " + newColumn.Default
+		}
+		rev = append(rev, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", tablename, newColumn.Name, strAction))
+	}
+	if !sqlExprEqual(oldColumn.Check, newColumn.Check) {
+		//约束按改名前的字段名查询
+		drops, err := p.dropColumnCheckSql(tablename, oldColumn.Name)
+		if err != nil {
+			return nil, err
+		}
+		rev = append(rev, drops...)
+		if newColumn.Check != "" {
+			rev = append(rev, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)",
+				tablename, checkName(tablename, newColumn.Name), newColumn.Check))
+		}
+	}
+	if oldColumn.NotNull != newColumn.NotNull {
+		strAction := "DROP NOT NULL"
+		if newColumn.NotNull {
+			strAction = "SET NOT NULL"
+		}
+		rev = append(rev, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", tablename, newColumn.Name, strAction))
+	}
+	if !oldColumn.storedDesc().Equal(newColumn.storedDesc()) {
+		rev = append(rev, p.alterColumnDescSql(tablename, newColumn.Name, newColumn.storedDesc()))
+	}
+	return rev, nil
+}
+func (p *postgresMeta) CreateIndex(tableName, indexName string, columns []string, unique bool, desc DBDesc) error {
+	return p.execDDL(&SchemaChange{Op: OpCreateIndex, TableName: tableName, Name: indexName,
+		Index: &Index{columns, unique, desc}})
+}
+func (p *postgresMeta) createIndexSql(tableName, indexName string, columns []string, unique bool, desc DBDesc) []string {
+	strUnique := ""
+	if unique {
+		strUnique = "UNIQUE "
+	}
+	rev := []string{fmt.Sprintf("CREATE %sINDEX %s ON %s(%s)", strUnique, indexName, tableName, strings.Join(columns, ","))}
+	if !desc.IsEmpty() {
+		rev = append(rev, p.alterIndexDescSql(tableName, indexName, desc))
+	}
+	return rev
+}
+func (p *postgresMeta) DropIndex(tablename, indexname string) error {
+	return p.execDDL(&SchemaChange{Op: OpDropIndex, TableName: tablename, Name: indexname})
+}
+func (p *postgresMeta) dropIndexSql(tablename, indexname string) string {
+	return fmt.Sprintf("DROP INDEX %s%s", pgSchemaPrefix(tablename), indexname)
+}
+func (p *postgresMeta) AlterIndex(tablename, indexname string, oldIndex, newIndex *Index) error {
+	return p.execDDL(&SchemaChange{Op: OpAlterIndex, TableName: tablename, Name: indexname, OldIndex: oldIndex, Index: newIndex})
+}
+
+//the statements of the postgres are built alone,the queried names are of the struct before the changes
+func (p *postgresMeta) BuildDDL(changes []*SchemaChange) ([][]string, error) {
+	rev := make([][]string, len(changes))
+	for i, c := range changes {
+		var err error
+		switch c.Op {
+		case OpCreateTable:
+			rev[i], err = p.createTableSql(c.Table)
+		case OpDropForeignKey:
+			rev[i] = []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", c.TableName, c.Name)}
+		case OpDropPrimaryKey:
+			var strSql string
+			strSql, err = p.dropPrimaryKeySql(c.TableName)
+			rev[i] = []string{strSql}
+		case OpDropColumn:
+			rev[i] = []string{dropColumnSql(c.TableName, c.Name)}
+		case OpAlterColumn:
+			rev[i], err = p.alterColumnSql(c.TableName, c.OldColumn, c.Column)
+		case OpAddColumn:
+			rev[i], err = p.addColumnSql(c.TableName, c.Column)
+		case OpAddPrimaryKey:
+			rev[i] = []string{addPrimaryKeySql(c.TableName, c.PK)}
+		case OpAlterIndex:
+			if reflect.DeepEqual(c.OldIndex.Columns, c.Index.Columns) && c.OldIndex.Unique == c.Index.Unique {
+				rev[i] = []string{p.alterIndexDescSql(c.TableName, c.Name, c.Index.Desc)}
+			} else {
+				rev[i] = append([]string{p.dropIndexSql(c.TableName, c.Name)},
+					p.createIndexSql(c.TableName, c.Name, c.Index.Columns, c.Index.Unique, c.Index.Desc)...)
+			}
+		case OpDropIndex:
+			rev[i] = []string{p.dropIndexSql(c.TableName, c.Name)}
+		case OpCreateIndex:
+			rev[i] = p.createIndexSql(c.TableName, c.Name, c.Index.Columns, c.Index.Unique, c.Index.Desc)
+		case OpAddForeignKey:
+			rev[i] = p.addForeignKeySql(c.TableName, c.ForeignKey)
+		case OpAlterTableDesc:
+			rev[i] = []string{fmt.Sprintf("COMMENT ON TABLE %s IS %s", c.TableName, p.descExpress(c.Desc))}
+		default:
+			err = fmt.Errorf("the op %q not support by postgres", c.Op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rev, nil
+}
+
+//build the statements of the changes and execute them in a transaction
+func (p *postgresMeta) execDDL(changes ...*SchemaChange) error {
+	return p.inTrans(func(p *postgresMeta) error {
+		return execDDL(p.DBHelper, p, changes...)
+	})
+}
+
+//merge the source rows into dest,sqlWhere filter the source rows.
+//autoRemove will delete the dest rows that not in the source
+func (p *postgresMeta) Merge(dest, source string, colNames []string, pkColumns []string, autoUpdate, autoRemove bool, sqlWhere string) error {
+	if len(pkColumns) == 0 {
+		return fmt.Errorf("the merge primary key is empty")
+	}
+	if sqlWhere == "" {
+		sqlWhere = "1=1"
+	}
+	strInsert := fmt.Sprintf("INSERT INTO %s(%s)\nSELECT %s FROM %s src WHERE %s\n%s",
+		dest, strings.Join(colNames, ","), strings.Join(colNames, ","), source, sqlWhere, onConflictClause(colNames, pkColumns, autoUpdate))
+	return p.inTrans(func(p *postgresMeta) error {
+		if autoRemove {
+			joins := make([]string, len(pkColumns))
+			for i, pk := range pkColumns {
+				joins[i] = fmt.Sprintf("src.%s = dest.%s", pk, pk)
+			}
+			if _, err := p.DBHelper.Exec(fmt.Sprintf("DELETE FROM %s dest WHERE NOT EXISTS(\n\tSELECT 1 FROM %s src WHERE %s AND (%s))",
+				dest, source, strings.Join(joins, " AND "), sqlWhere)); err != nil {
+				return err
+			}
+		}
+		_, err := p.DBHelper.Exec(strInsert)
+		return err
+	})
+}
+func (p *postgresMeta) TransactionalDDL() bool {
+	return true
+}
+func (p *postgresMeta) MaxParams() int {
+	return 65535
+}
+func (p *postgresMeta) NullSafeEqual(column, placeholder string) string {
+	return fmt.Sprintf("%s IS NOT DISTINCT FROM %s", column, placeholder)
+}
+func (p *postgresMeta) BuildInsertReturningSql(tablename string, cols, returnCols []string) string {
+	return insertReturningSql(tablename, cols, returnCols)
+}
+func (p *postgresMeta) BuildUpsertSql(tablename string, cols, pkColumns []string) string {
+	return fmt.Sprintf("INSERT INTO %s(%s)VALUES(%s)\n%s",
+		tablename, strings.Join(cols, ","), valuesPlaceholder(len(cols)), onConflictClause(cols, pkColumns, true))
+}
+
+//classify the error by the SQLSTATE(lib/pq and pgx implement SQLState)
+func (p *postgresMeta) ClassifyError(err error) ErrorKind {
+	var e interface {
+		SQLState() string
+	}
+	if !errors.As(err, &e) {
+		return ErrorUnknown
+	}
+	switch e.SQLState() {
+	case "23505":
+		return ErrorUniqueViolation
+	case "23503":
+		return ErrorForeignKeyViolation
+	case "23502":
+		return ErrorNotNullViolation
+	case "23514":
+		return ErrorCheckViolation
+	case "40P01":
+		return ErrorDeadlock
+	case "40001":
+		return ErrorSerializationFailure
+	case "55P03":
+		return ErrorLockTimeout
+	}
+	return ErrorUnknown
+}
+
+//run fn in a transaction,the postgresMeta passed to fn is bind to the transaction
+func (p *postgresMeta) inTrans(fn func(p *postgresMeta) error) error {
+	return p.RootMeta.inTrans(func(h *DBHelper) error {
+		tm := *p
+		tm.DBHelper = h
+		return fn(&tm)
+	})
+}
+
+//the types of the driver support the COPY FROM STDIN by the prepared statement
+var pgCopyDrivers = map[string]bool{"*pq.Driver": true}
+
+//BulkLoad load the rows by the COPY FROM STDIN,the driver must support it(lib/pq),
+//else return the ErrBulkLoadUnsupported and the rows are inserted by the multi-row INSERT.
+//the driver is checked before the COPY,a failed statement abort the transaction of the postgres
+func (p *postgresMeta) BulkLoad(ctx context.Context, tablename string, cols []string, rows [][]interface{}) (rcount int64, err error) {
+	if p.DBHelper.db == nil {
+		return 0, ErrNotOpen
+	}
+	if !pgCopyDrivers[reflect.TypeOf(p.DBHelper.db.Driver()).String()] {
+		return 0, ErrBulkLoadUnsupported
+	}
+	err = p.inTrans(func(p *postgresMeta) error {
+		h := p.DBHelper
+		strSql := fmt.Sprintf("COPY %s (%s) FROM STDIN", tablename, strings.Join(cols, ", "))
+		stmt, err := h.prepareTx(ctx, strSql)
+		if err != nil {
+			return h.sqlError(strSql, err)
+		}
+		defer stmt.Close()
+		for _, r := range rows {
+			if _, err = h.execStmt(ctx, stmt, strSql, r); err != nil {
+				return h.sqlError(strSql, err, r...)
+			}
+		}
+		//无参数的执行结束COPY
+		if _, err = h.execStmt(ctx, stmt, strSql, nil); err != nil {
+			return h.sqlError(strSql, err)
+		}
+		rcount = int64(len(rows))
+		return nil
+	})
+	return
+}
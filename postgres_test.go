@@ -0,0 +1,82 @@
+package dbhelper
+
+import (
+	"context"
+	"errors"
+	"github.com/linlexing/datatable.go"
+	"testing"
+)
+
+func Test_pgParseType(t *testing.T) {
+	cases := []struct {
+		dbType  string
+		colType datatable.ColumnType
+		maxSize int
+	}{
+		{"text", datatable.String, 0},
+		{"character varying(20)", datatable.String, 20},
+		{"character(2)", datatable.String, 2},
+		{"bigint", datatable.Int64, 0},
+		{"integer", datatable.Int64, 0},
+		{"double precision", datatable.Float64, 0},
+		{"numeric(10,2)", datatable.Float64, 0},
+		{"timestamp without time zone", datatable.Time, 0},
+		{"date", datatable.Time, 0},
+		{"boolean", datatable.Bool, 0},
+	}
+	for _, c := range cases {
+		colType, maxSize := pgParseType(c.dbType)
+		if colType != c.colType || maxSize != c.maxSize {
+			t.Errorf("%q parse to %v(%d),expect %v(%d)", c.dbType, colType, maxSize, c.colType, c.maxSize)
+		}
+	}
+}
+
+func Test_pgCheckExpr(t *testing.T) {
+	if got := pgCheckExpr("CHECK ((price > (0)::numeric))"); got != "(price > (0)::numeric)" {
+		t.Errorf("got %q", got)
+	}
+	if !sqlExprEqual(pgCheckExpr("CHECK ((price > (0)::numeric))"), "price > 0") {
+		t.Error("the check should be equal")
+	}
+	if !sqlExprEqual("'new'::character varying", "'new'") {
+		t.Error("the default should be equal")
+	}
+	if sqlExprEqual("'New'", "'new'") || sqlExprEqual("x > 1", "x > 2") {
+		t.Error("the different expression should not be equal")
+	}
+	if !sqlExprEqual("CURRENT_TIMESTAMP", "current_timestamp") {
+		t.Error("the keyword should be compared ignore case")
+	}
+	if p, s, ok := parseNumericType("numeric(12,3)"); !ok || p != 12 || s != 3 {
+		t.Errorf("got %d,%d,%v", p, s, ok)
+	}
+}
+func Test_pgColumnDefineIdentity(t *testing.T) {
+	p := &postgresMeta{}
+	col := &TableColumn{Name: "id", Type: datatable.Int64, NotNull: true, Desc: DBDesc{DescGenerated: true}}
+	define, err := p.columnDefine("t", col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "id BIGINT GENERATED BY DEFAULT AS IDENTITY NOT NULL"; define != expect {
+		t.Errorf("got %s,expect %s", define, expect)
+	}
+}
+func Test_pgBulkLoadUnsupported(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakePgDriverName)
+	defer h.Close()
+	//非lib/pq驱动不执行COPY,退回到INSERT
+	_, err := h.metaHelper.(BulkLoader).BulkLoad(context.Background(), "t", []string{"a"}, [][]interface{}{{1}})
+	if !errors.Is(err, ErrBulkLoadUnsupported) {
+		t.Errorf("got %v", err)
+	}
+	if log := fakeTxLog(); len(log) != 0 {
+		t.Errorf("got %v", log)
+	}
+	if execs := fakeReset(); len(execs) != 0 {
+		t.Errorf("the COPY executed %v", execs)
+	}
+}
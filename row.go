@@ -0,0 +1,32 @@
+package dbhelper
+
+import (
+	"database/sql"
+)
+
+//Row is the result of calling QueryRow to select a single row,
+//like sql.Row but also carry the error of the sql template
+type Row struct {
+	row    *sql.Row
+	h      *DBHelper
+	strSql string
+	args   []interface{}
+	err    error
+}
+
+func (r *Row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	err := r.row.Scan(dest...)
+	if err != nil && err != sql.ErrNoRows {
+		err = r.h.sqlError(r.strSql, err, r.args...)
+	}
+	return err
+}
+func (r *Row) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.row.Err()
+}
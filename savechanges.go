@@ -0,0 +1,195 @@
+package dbhelper
+
+import (
+	"context"
+	"fmt"
+	"github.com/linlexing/datatable.go"
+	"strings"
+)
+
+//SaveChanges save the change of the tables in one transaction,the tables are ordered by the foreign keys:
+//the rows are inserted parent table first,then updated,and deleted child table first,so the row can be
+//moved to the new parent or away from the deleted parent.the deleted row that the key is added again is
+//deleted(child table first) before the insert.the ForeignKeys of the DataTable is used,if it's empty,read from the db
+func (h *DBHelper) SaveChanges(tables ...*DataTable) (int64, error) {
+	return h.SaveChangesContext(h.context(), tables...)
+}
+func (h *DBHelper) SaveChangesContext(ctx context.Context, tables ...*DataTable) (rcount int64, err error) {
+	refs, err := h.tableReferences(tables)
+	if err != nil {
+		return
+	}
+	order, err := dependencyOrder(tables, refs)
+	if err != nil {
+		return
+	}
+	changes := make([]*datatable.TableChange, len(order))
+	for i, table := range order {
+		changes[i] = table.GetChange()
+	}
+	return h.saveChanges(ctx, order, changes)
+}
+
+//save the changes of the ordered tables(parent first) in one transaction
+func (h *DBHelper) saveChanges(ctx context.Context, order []*DataTable, changes []*datatable.TableChange) (rcount int64, err error) {
+	err = h.InTxContext(ctx, func(th *DBHelper) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				switch p := p.(type) {
+				case error:
+					err = p
+				default:
+					err = fmt.Errorf("%s", p)
+				}
+			}
+		}()
+		rcount = 0
+		var iCount int64
+		var conflicts [][]interface{}
+		readded := make([][]*datatable.DataRow, len(order))
+		deletes := make([][]*datatable.DataRow, len(order))
+		for i, table := range order {
+			readded[i], deletes[i] = splitReaddedRows(table, changes[i].DeleteRows, changes[i].InsertRows)
+		}
+		//子表先删除
+		deleteAll := func(rows [][]*datatable.DataRow) error {
+			for i := len(order) - 1; i >= 0; i-- {
+				if iCount, conflicts, err = deleteRows(ctx, th, order[i], rows[i]); err != nil {
+					return err
+				}
+				if len(conflicts) > 0 {
+					return &ConcurrentUpdateError{TableName: order[i].TableName, Keys: conflicts}
+				}
+				rcount += iCount
+			}
+			return nil
+		}
+		//重新插入的主键先删除
+		if err = deleteAll(readded); err != nil {
+			return
+		}
+		//父表先插入
+		for i, table := range order {
+			if iCount, err = th.insertChangeRows(ctx, table, changes[i].InsertRows); err != nil {
+				return
+			}
+			rcount += iCount
+		}
+		for i, table := range order {
+			if iCount, conflicts, err = updateRows(ctx, th, table, changes[i].UpdateRows); err != nil {
+				return
+			}
+			if len(conflicts) > 0 {
+				return &ConcurrentUpdateError{TableName: table.TableName, Keys: conflicts}
+			}
+			rcount += iCount
+		}
+		err = deleteAll(deletes)
+		return
+	}, nil)
+	return
+}
+
+//split the deleted rows to the rows that the primary key is inserted again and the others
+func splitReaddedRows(table *DataTable, deletes, inserts []*datatable.DataRow) (readded, others []*datatable.DataRow) {
+	if len(table.PK) == 0 || len(inserts) == 0 {
+		return nil, deletes
+	}
+	keys := map[string]bool{}
+	for _, r := range inserts {
+		keys[fmt.Sprintf("%#v", columnValues(table, r.Data, table.PK))] = true
+	}
+	for _, r := range deletes {
+		if keys[fmt.Sprintf("%#v", originValues(table, r, table.PK))] {
+			readded = append(readded, r)
+		} else {
+			others = append(others, r)
+		}
+	}
+	return
+}
+
+//the referenced table names of each table
+func (h *DBHelper) tableReferences(tables []*DataTable) ([][]string, error) {
+	rev := make([][]string, len(tables))
+	for i, table := range tables {
+		if len(table.ForeignKeys) > 0 {
+			for _, fk := range table.ForeignKeys {
+				rev[i] = append(rev[i], fk.RefTable)
+			}
+			continue
+		}
+		fks, err := h.metaHelper.GetForeignKeys(table.TableName)
+		if err != nil {
+			return nil, err
+		}
+		for _, fk := range fks {
+			rev[i] = append(rev[i], fk.RefTable)
+		}
+	}
+	return rev, nil
+}
+
+//the table name equal the referenced name,the schema is ignored if one of them has no schema
+func sameTableName(name, ref string) bool {
+	if strings.EqualFold(name, ref) {
+		return true
+	}
+	if idx := strings.LastIndex(name, "."); idx >= 0 && !strings.Contains(ref, ".") {
+		return strings.EqualFold(name[idx+1:], ref)
+	}
+	if idx := strings.LastIndex(ref, "."); idx >= 0 && !strings.Contains(name, ".") {
+		return strings.EqualFold(ref[idx+1:], name)
+	}
+	return false
+}
+
+//order the tables parent first,the tables not related keep the order of the input.
+//the reference to the table not in the tables and to itself is ignored,the cycle is an error
+func dependencyOrder(tables []*DataTable, refs [][]string) ([]*DataTable, error) {
+	//parents[i] is the index of the tables referenced by the tables[i]
+	parents := make([]map[int]bool, len(tables))
+	for i := range tables {
+		parents[i] = map[int]bool{}
+		for _, ref := range refs[i] {
+			for j, parent := range tables {
+				if j != i && sameTableName(parent.TableName, ref) {
+					parents[i][j] = true
+				}
+			}
+		}
+	}
+	rev := make([]*DataTable, 0, len(tables))
+	done := make([]bool, len(tables))
+	for len(rev) < len(tables) {
+		found := false
+		for i, table := range tables {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for j := range parents[i] {
+				if !done[j] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[i] = true
+				rev = append(rev, table)
+				found = true
+				break
+			}
+		}
+		if !found {
+			names := []string{}
+			for i, table := range tables {
+				if !done[i] {
+					names = append(names, table.TableName)
+				}
+			}
+			return nil, fmt.Errorf("the foreign keys of the tables is cyclic:%s", strings.Join(names, ","))
+		}
+	}
+	return rev, nil
+}
@@ -0,0 +1,149 @@
+package dbhelper
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/linlexing/datatable.go"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_dependencyOrder(t *testing.T) {
+	detail := NewDataTable("order_detail")
+	orders := NewDataTable("orders")
+	product := NewDataTable("product")
+	refs := [][]string{{"orders", "public.product"}, {"orders"}, nil}
+	order, err := dependencyOrder([]*DataTable{detail, orders, product}, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, table := range order {
+		names = append(names, table.TableName)
+	}
+	if names[0] != "orders" || names[1] != "product" || names[2] != "order_detail" {
+		t.Errorf("got %v", names)
+	}
+
+	refs[2] = []string{"ORDER_DETAIL"}
+	if _, err := dependencyOrder([]*DataTable{detail, orders, product}, refs); err == nil {
+		t.Error("the cyclic foreign keys should fail")
+	}
+}
+
+//the statement kind and the table name,e.g. "INSERT orders"
+func statementTables(execs []fakeExec) []string {
+	rev := []string{}
+	for _, e := range execs {
+		fields := strings.Fields(strings.NewReplacer("(", " ").Replace(e.query))
+		switch fields[0] {
+		case "UPDATE":
+			rev = append(rev, fields[0]+" "+fields[1])
+		default:
+			rev = append(rev, fields[0]+" "+fields[2])
+		}
+	}
+	return rev
+}
+func Test_saveChanges(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeDriverName)
+	defer h.Close()
+	orders := NewDataTable("orders")
+	orders.AddColumn(NewDataColumn("id", datatable.Int64, 0, true))
+	orders.SetPK("id")
+	orders.SetPKOnly(true)
+	detail := NewDataTable("order_detail")
+	detail.AddColumn(NewDataColumn("id", datatable.Int64, 0, true))
+	detail.AddColumn(NewDataColumn("order_id", datatable.Int64, 0, true))
+	detail.SetPK("id")
+	detail.SetPKOnly(true)
+	detail.AddForeignKey("fk_detail_order", &ForeignKey{[]string{"order_id"}, "orders", []string{"id"}, "", "", DBDesc{}})
+	//orders没有声明外键,从库中读取
+	fakeResult("PRAGMA foreign_key_list(orders)", []string{"id", "seq", "table", "from", "to", "on_update", "on_delete"})
+
+	refs, err := h.tableReferences([]*DataTable{detail, orders})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := dependencyOrder([]*DataTable{detail, orders}, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//新增订单2,明细10从订单1移到订单2,删除订单1
+	changes := func() []*datatable.TableChange {
+		return []*datatable.TableChange{
+			{
+				InsertRows: []*datatable.DataRow{{Data: []interface{}{int64(2)}}},
+				DeleteRows: []*datatable.DataRow{{Data: []interface{}{int64(1)}, OriginData: []interface{}{int64(1)}}},
+			},
+			{
+				UpdateRows: []*datatable.DataRow{{Data: []interface{}{int64(10), int64(2)}, OriginData: []interface{}{int64(10), int64(1)}}},
+			},
+		}
+	}
+	if _, err := h.saveChanges(h.context(), order, changes()); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"BEGIN", "COMMIT"}; !reflect.DeepEqual(fakeTxLog(), expect) {
+		t.Errorf("got %v,expect %v", fakeTxLog(), expect)
+	}
+	got := statementTables(fakeReset())
+	if expect := []string{"INSERT orders", "UPDATE order_detail", "DELETE orders"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %v,expect %v", got, expect)
+	}
+
+	//删除失败,全部回滚
+	fakeFail("DELETE FROM orders", errors.New("FOREIGN KEY constraint failed"))
+	if _, err := h.saveChanges(h.context(), order, changes()); err == nil {
+		t.Fatal("the delete should fail")
+	}
+	if expect := []string{"BEGIN", "ROLLBACK"}; !reflect.DeepEqual(fakeTxLog(), expect) {
+		t.Errorf("got %v,expect %v", fakeTxLog(), expect)
+	}
+	fakeReset()
+
+	//删除后重新插入订单1和明细10,并删除明细11,重新插入的主键先删除
+	readded := []*datatable.TableChange{
+		{
+			InsertRows: []*datatable.DataRow{{Data: []interface{}{int64(1)}}},
+			DeleteRows: []*datatable.DataRow{{Data: []interface{}{int64(1)}, OriginData: []interface{}{int64(1)}}},
+		},
+		{
+			InsertRows: []*datatable.DataRow{{Data: []interface{}{int64(10), int64(1)}}},
+			DeleteRows: []*datatable.DataRow{
+				{Data: []interface{}{int64(10), int64(1)}, OriginData: []interface{}{int64(10), int64(1)}},
+				{Data: []interface{}{int64(11), int64(1)}, OriginData: []interface{}{int64(11), int64(1)}},
+			},
+		},
+	}
+	if _, err := h.saveChanges(h.context(), order, readded); err != nil {
+		t.Fatal(err)
+	}
+	got = statementTables(fakeReset())
+	if expect := []string{"DELETE order_detail", "DELETE orders", "INSERT orders", "INSERT order_detail", "DELETE order_detail"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %v,expect %v", got, expect)
+	}
+}
+func Test_tableReferences(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeDriverName)
+	defer h.Close()
+	fakeResult("PRAGMA foreign_key_list(order_detail)", []string{"id", "seq", "table", "from", "to", "on_update", "on_delete"},
+		[]driver.Value{int64(0), int64(0), "orders", "order_id", "id", "NO ACTION", "CASCADE"})
+	fakeResult("PRAGMA foreign_key_list(orders)", []string{"id", "seq", "table", "from", "to", "on_update", "on_delete"})
+	fakeResult("SELECT sql FROM sqlite_master WHERE type='table' AND name=?\nUNION ALL\nSELECT sql FROM sqlite_temp_master WHERE type='table' AND name=?",
+		[]string{"sql"}, []driver.Value{"CREATE TABLE order_detail(id INTEGER,order_id INTEGER,CONSTRAINT fk_detail_order FOREIGN KEY(order_id) REFERENCES orders(id))"})
+	fakeResult("SELECT name FROM sqlite_master WHERE type='table' AND name=?\nUNION ALL\nSELECT name FROM sqlite_temp_master WHERE type='table' AND name=?",
+		[]string{"name"})
+	refs, err := h.tableReferences([]*DataTable{NewDataTable("order_detail"), NewDataTable("orders")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := [][]string{{"orders"}, nil}; !reflect.DeepEqual(refs, expect) {
+		t.Errorf("got %v,expect %v", refs, expect)
+	}
+}
@@ -0,0 +1,54 @@
+package dbhelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_NestedTrans(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := NewDBHelper(fakeDriverName, "")
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	t1, err := h.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := t1.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t3, err := t2.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := t3.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := t2.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Commit(); err == nil {
+		t.Error("commit without trans should fail")
+	}
+	got := []string{}
+	for _, e := range fakeReset() {
+		got = append(got, e.query)
+	}
+	expect := []string{
+		"SAVEPOINT dbhelper_sp1",
+		"SAVEPOINT dbhelper_sp2",
+		"ROLLBACK TO SAVEPOINT dbhelper_sp2",
+		"RELEASE SAVEPOINT dbhelper_sp2",
+		"RELEASE SAVEPOINT dbhelper_sp1",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %q,expect %q", got, expect)
+	}
+}
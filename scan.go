@@ -0,0 +1,146 @@
+package dbhelper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+//the struct is scanned by fields,other type(include sql.Scanner and time.Time) is scanned as one column
+func isStructScan(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(scannerType)
+}
+
+//match the columns to the fields,the db tag or the field name equal the column first,
+//then case-insensitive.return the index of the field for every column,-1 is not found
+func matchColumns(fields []*structField, cols []string) []int {
+	rev := make([]int, len(cols))
+	for i, col := range cols {
+		rev[i] = -1
+		for j, f := range fields {
+			if f.Name == col {
+				rev[i] = j
+				break
+			}
+		}
+		if rev[i] > -1 {
+			continue
+		}
+		for j, f := range fields {
+			if strings.EqualFold(f.Name, col) {
+				rev[i] = j
+				break
+			}
+		}
+	}
+	return rev
+}
+
+//the field for scan,alloc the nil embedded pointer
+func fieldForScan(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+//scan the rows to the slice of T,limit > 0 stop after limit rows.close the rows
+func scanRows[T any](rows *sql.Rows, limit int) ([]T, error) {
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	var fields []*structField
+	var colFields []int
+	if isStructScan(t) {
+		fields = structFields(t)
+		colFields = matchColumns(fields, cols)
+	} else if len(cols) != 1 {
+		return nil, fmt.Errorf("scan %d columns into the %s,must be one column", len(cols), t)
+	}
+	rev := []T{}
+	for (limit <= 0 || len(rev) < limit) && rows.Next() {
+		var item T
+		v := reflect.ValueOf(&item).Elem()
+		dest := make([]interface{}, len(cols))
+		if fields == nil {
+			dest[0] = &item
+		} else {
+			for i, fi := range colFields {
+				if fi < 0 {
+					//结构中没有对应的字段,丢弃
+					dest[i] = new(interface{})
+				} else {
+					dest[i] = fieldForScan(v, fields[fi].Index).Addr().Interface()
+				}
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		rev = append(rev, item)
+	}
+	return rev, rows.Err()
+}
+
+//Select query the rows into the slice of T.
+//T is struct,the column is mapped to the field by the db tag(or the field name),case-insensitive if not equal.
+//the nullable column should map to the pointer or sql.Null* field.
+//if T isn't struct(or is sql.Scanner),the query must return only one column
+func Select[T any](h *DBHelper, query string, args ...interface{}) ([]T, error) {
+	return SelectTContext[T](h, h.context(), query, nil, args...)
+}
+func SelectContext[T any](h *DBHelper, ctx context.Context, query string, args ...interface{}) ([]T, error) {
+	return SelectTContext[T](h, ctx, query, nil, args...)
+}
+func SelectT[T any](h *DBHelper, query string, templateParam map[string]interface{}, args ...interface{}) ([]T, error) {
+	return SelectTContext[T](h, h.context(), query, templateParam, args...)
+}
+func SelectTContext[T any](h *DBHelper, ctx context.Context, query string, templateParam map[string]interface{}, args ...interface{}) ([]T, error) {
+	rows, err := h.QueryTContext(ctx, query, templateParam, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows[T](rows, 0)
+}
+
+//Get query the first row into T,return nil if no row
+func Get[T any](h *DBHelper, query string, args ...interface{}) (*T, error) {
+	return GetTContext[T](h, h.context(), query, nil, args...)
+}
+func GetContext[T any](h *DBHelper, ctx context.Context, query string, args ...interface{}) (*T, error) {
+	return GetTContext[T](h, ctx, query, nil, args...)
+}
+func GetT[T any](h *DBHelper, query string, templateParam map[string]interface{}, args ...interface{}) (*T, error) {
+	return GetTContext[T](h, h.context(), query, templateParam, args...)
+}
+func GetTContext[T any](h *DBHelper, ctx context.Context, query string, templateParam map[string]interface{}, args ...interface{}) (*T, error) {
+	rows, err := h.QueryTContext(ctx, query, templateParam, args...)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := scanRows[T](rows, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(rev) == 0 {
+		return nil, nil
+	}
+	return &rev[0], nil
+}
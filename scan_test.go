@@ -0,0 +1,52 @@
+package dbhelper
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+)
+
+func Test_Select(t *testing.T) {
+	defer fakeReset()
+	type User struct {
+		ID    int64  `db:"id"`
+		Name  string `db:"user_name"`
+		Email *string
+		Age   sql.NullInt64
+	}
+	fakeResult("select * from users", []string{"id", "USER_NAME", "email", "age", "other"},
+		[]driver.Value{int64(1), "tom", "tom@a.com", int64(20), "x"},
+		[]driver.Value{int64(2), "jerry", nil, nil, "y"})
+	h := NewDBHelper(fakeDriverName, "")
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	users, err := Select[User](h, "select * from users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != 1 || users[0].Name != "tom" || users[0].Email == nil || *users[0].Email != "tom@a.com" ||
+		!users[0].Age.Valid || users[0].Age.Int64 != 20 {
+		t.Errorf("got %#v", users)
+	}
+	if users[1].Email != nil || users[1].Age.Valid {
+		t.Errorf("the null value expected,got %#v", users[1])
+	}
+	user, err := Get[User](h, "select * from users")
+	if err != nil || user == nil || user.ID != 1 {
+		t.Errorf("got %#v,%v", user, err)
+	}
+	fakeResult("select id from users", []string{"id"}, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+	ids, err := Select[int64](h, "select id from users")
+	if err != nil || len(ids) != 2 || ids[1] != 2 {
+		t.Errorf("got %v,%v", ids, err)
+	}
+	if _, err = Select[int64](h, "select * from users"); err == nil {
+		t.Error("the column number error expected")
+	}
+	fakeResult("select * from empty", []string{"id"})
+	if user, err = Get[User](h, "select * from empty"); err != nil || user != nil {
+		t.Errorf("got %#v,%v", user, err)
+	}
+}
@@ -1,23 +1,148 @@
 package dbhelper
 
 import (
+	"errors"
 	"fmt"
-	"github.com/davecgh/go-spew/spew"
+	"strings"
 )
 
+var (
+	ErrNotOpen     = errors.New("db not open")
+	ErrAlreadyOpen = errors.New("db already open")
+	//Begin on the DBHelper of a transaction,and the MetaHelper not support the savepoint
+	ErrTxAlreadyBegun = errors.New("already begin trans")
+	//Commit or Rollback on the DBHelper not bind to a transaction
+	ErrTxNotBegun = errors.New("the trans not begin")
+	//the update of SaveChange affect no row,the record was changed or deleted by other user
+	ErrConcurrentUpdate = errors.New("record can't update,maybe other user changed the record")
+)
+
+//ErrorKind is the classification of the SqlError
+type ErrorKind int
+
+const (
+	ErrorUnknown ErrorKind = iota
+	ErrorUniqueViolation
+	ErrorForeignKeyViolation
+	ErrorNotNullViolation
+	ErrorCheckViolation
+	ErrorDeadlock
+	ErrorSerializationFailure
+	ErrorLockTimeout
+	ErrorConcurrentUpdate
+)
+
+var errorKindNames = []string{
+	"unknown",
+	"unique violation",
+	"foreign key violation",
+	"not null violation",
+	"check violation",
+	"deadlock",
+	"serialization failure",
+	"lock timeout",
+	"concurrent update",
+}
+
+func (k ErrorKind) String() string {
+	if k < 0 || int(k) >= len(errorKindNames) {
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+	return errorKindNames[k]
+}
+
+//Retryable return true if the transaction failed by the kind can be run again
+func (k ErrorKind) Retryable() bool {
+	return k == ErrorDeadlock || k == ErrorSerializationFailure || k == ErrorLockTimeout
+}
+
+//ErrorClassifier is implemented by the MetaHelper that can classify the error returned by the driver
+type ErrorClassifier interface {
+	ClassifyError(err error) ErrorKind
+}
+
+//SqlError is the error of the statement,Err is the error returned by the driver
 type SqlError struct {
-	sql    string
-	params interface{}
-	err    error
+	SQL    string
+	Params []interface{}
+	Kind   ErrorKind
+	Err    error
 }
 
 func (s *SqlError) Error() string {
-	return fmt.Sprintf("%v:\n%v\nparams:%v\n", s.err, s.sql, spew.Sdump(s.params))
+	return fmt.Sprintf("%v:\n%v\nparams:%v\n", s.Err, s.SQL, s.Params)
+}
+func (s *SqlError) Unwrap() error {
+	return s.Err
 }
 func NewSqlError(strSql string, err error, params ...interface{}) *SqlError {
-	return &SqlError{
-		sql:    strSql,
-		params: params,
-		err:    err,
+	rev := &SqlError{
+		SQL:    strSql,
+		Params: params,
+		Err:    err,
+	}
+	if err == ErrConcurrentUpdate {
+		rev.Kind = ErrorConcurrentUpdate
+	}
+	return rev
+}
+
+//ConcurrentUpdateError is returned by SaveChange when the rows were changed or deleted by other user,
+//errors.Is(err, ErrConcurrentUpdate) is true
+type ConcurrentUpdateError struct {
+	TableName string
+	//the primary key values(origin) of the conflict rows
+	Keys [][]interface{}
+}
+
+func (c *ConcurrentUpdateError) Error() string {
+	return fmt.Sprintf("%v,table:%s,keys:%v", ErrConcurrentUpdate, c.TableName, c.Keys)
+}
+func (c *ConcurrentUpdateError) Is(target error) bool {
+	return target == ErrConcurrentUpdate
+}
+
+//ErrorKindOf return the Kind of the SqlError in the err chain,ErrorUnknown if not found
+func ErrorKindOf(err error) ErrorKind {
+	var e *SqlError
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	var c *ConcurrentUpdateError
+	if errors.As(err, &c) {
+		return ErrorConcurrentUpdate
+	}
+	return ErrorUnknown
+}
+
+//the SqlError classified by the MetaHelper
+func (h *DBHelper) sqlError(strSql string, err error, params ...interface{}) *SqlError {
+	rev := NewSqlError(strSql, err, params...)
+	if c, ok := h.metaHelper.(ErrorClassifier); ok && rev.Kind == ErrorUnknown {
+		rev.Kind = c.ClassifyError(err)
+	}
+	return rev
+}
+
+//TemplateError is the error of the sql template parse or execute
+type TemplateError struct {
+	sql string
+	err error
+}
+
+func (t *TemplateError) Error() string {
+	strSql := ""
+	for i, v := range strings.Split(t.sql, "\n") {
+		strSql += fmt.Sprintf("%d\t%s\n", i+1, v)
+	}
+	return fmt.Sprintf("%s\n%s", t.err, strSql)
+}
+func (t *TemplateError) Unwrap() error {
+	return t.err
+}
+func NewTemplateError(strSql string, err error) *TemplateError {
+	return &TemplateError{
+		sql: strSql,
+		err: err,
 	}
 }
@@ -0,0 +1,48 @@
+package dbhelper
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "pq: " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func Test_SqlError(t *testing.T) {
+	h := NewDBHelper(fakeDriverName, "")
+	if _, err := h.Exec("delete from t"); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("got %v,expect ErrNotOpen", err)
+	}
+	err := fmt.Errorf("save fail:%w", NewSqlError("update t", ErrConcurrentUpdate, 1))
+	if !errors.Is(err, ErrConcurrentUpdate) || ErrorKindOf(err) != ErrorConcurrentUpdate {
+		t.Errorf("the %v should be the concurrent update", err)
+	}
+	var se *SqlError
+	if !errors.As(err, &se) || se.SQL != "update t" || len(se.Params) != 1 {
+		t.Errorf("the SqlError %#v", se)
+	}
+	se = h.sqlError("insert", errors.New("UNIQUE constraint failed: t.id"))
+	if se.Kind != ErrorUniqueViolation {
+		t.Errorf("got %v,expect unique violation", se.Kind)
+	}
+	cases := []struct {
+		meta ErrorClassifier
+		err  error
+		kind ErrorKind
+	}{
+		{&postgresMeta{}, sqlStateError("23503"), ErrorForeignKeyViolation},
+		{&postgresMeta{}, fmt.Errorf("wrap:%w", sqlStateError("40001")), ErrorSerializationFailure},
+		{&postgresMeta{}, errors.New("other"), ErrorUnknown},
+		{&mysqlMeta{}, errors.New("Error 1213 (40001): Deadlock found"), ErrorDeadlock},
+		{&mysqlMeta{}, errors.New("Error 1062: Duplicate entry '1' for key 'PRIMARY'"), ErrorUniqueViolation},
+		{&sqliteMeta{}, errors.New("database is locked"), ErrorLockTimeout},
+	}
+	for _, c := range cases {
+		if k := c.meta.ClassifyError(c.err); k != c.kind {
+			t.Errorf("%T classify %q to %v,expect %v", c.meta, c.err, k, c.kind)
+		}
+	}
+}
@@ -0,0 +1,1203 @@
+package dbhelper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/linlexing/datatable.go"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	//sqlite没有注释,表、字段、索引的描述保存在这个表中
+	sqliteDescTable = "dbhelper_desc"
+
+	sqliteDescKindTable  = "table"
+	sqliteDescKindColumn = "column"
+	sqliteDescKindIndex  = "index"
+	sqliteDescKindFK     = "foreignkey"
+
+	sqliteDescTableSql = "CREATE TABLE IF NOT EXISTS " + sqliteDescTable +
+		"(\n\ttablename TEXT NOT NULL,\n\tkind TEXT NOT NULL,\n\tname TEXT NOT NULL,\n\tcontent TEXT,\n\tPRIMARY KEY(tablename,kind,name))"
+)
+
+var (
+	sqliteTypeRegexp = regexp.MustCompile(`^\s*([^(]*?)\s*(?:\(\s*(\d+)\s*(?:,\s*\d+\s*)?\))?\s*$`)
+	//the named foreign key in the CREATE TABLE
+	sqliteFKRegexp = regexp.MustCompile(`(?i)CONSTRAINT\s+(\S+)\s+FOREIGN\s+KEY\s*\(([^)]*)\)`)
+	//the check and generated expression of the column define
+	sqliteCheckRegexp      = regexp.MustCompile(`(?i)\bCHECK\s*\(`)
+	sqliteGeneratedRegexp  = regexp.MustCompile(`(?i)\bGENERATED\s+ALWAYS\s+AS\s*\(`)
+	sqliteConstraintRegexp = regexp.MustCompile(`(?i)^(CONSTRAINT|PRIMARY|FOREIGN|UNIQUE|CHECK)\b`)
+)
+
+type sqliteMeta struct {
+	RootMeta
+	standardSavepoint
+}
+
+//the table struct used by rebuild
+type sqliteTable struct {
+	name        string
+	temporary   bool
+	columns     []*TableColumn
+	pks         []string
+	indexes     []*TableIndex
+	foreignKeys []*TableForeignKey
+	desc        DBDesc
+}
+
+func init() {
+	registerBuiltinMetaHelper("sqlite3", &sqliteMeta{})
+}
+
+//return a copy of the meta bind to the h
+func (s *sqliteMeta) Bind(h *DBHelper) MetaHelper {
+	rev := *s
+	rev.DBHelper = h
+	return &rev
+}
+
+func sqliteDBType(dataType datatable.ColumnType, maxSize int) (string, error) {
+	switch dataType {
+	case datatable.String:
+		if maxSize > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", maxSize), nil
+		}
+		return "TEXT", nil
+	case datatable.Int64:
+		return "INTEGER", nil
+	case datatable.Float64:
+		return "REAL", nil
+	case datatable.Time:
+		return "DATETIME", nil
+	case datatable.Bool:
+		return "BOOLEAN", nil
+	default:
+		return "", fmt.Errorf("the column type %v not support by sqlite", dataType)
+	}
+}
+
+//parse the declared type of sqlite,return the column type and max size
+func sqliteParseType(dbType string) (datatable.ColumnType, int) {
+	typeName := strings.ToUpper(dbType)
+	maxSize := 0
+	if m := sqliteTypeRegexp.FindStringSubmatch(dbType); m != nil {
+		typeName = strings.ToUpper(m[1])
+		if m[2] != "" {
+			maxSize, _ = strconv.Atoi(m[2])
+		}
+	}
+	//按照sqlite的类型亲和规则判断
+	switch {
+	case strings.Contains(typeName, "BOOL"):
+		return datatable.Bool, 0
+	case strings.Contains(typeName, "DATE"), strings.Contains(typeName, "TIME"):
+		return datatable.Time, 0
+	case strings.Contains(typeName, "INT"):
+		return datatable.Int64, 0
+	case strings.Contains(typeName, "CHAR"), strings.Contains(typeName, "CLOB"), strings.Contains(typeName, "TEXT"):
+		return datatable.String, maxSize
+	case strings.Contains(typeName, "REAL"), strings.Contains(typeName, "FLOA"), strings.Contains(typeName, "DOUB"),
+		strings.Contains(typeName, "NUM"), strings.Contains(typeName, "DEC"):
+		return datatable.Float64, 0
+	default:
+		return datatable.String, maxSize
+	}
+}
+func (s *sqliteMeta) StringExpress(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+func (s *sqliteMeta) ParamPlaceholder(num int) string {
+	return "?"
+}
+
+//the sqlite driver must register the regexp function
+func (s *sqliteMeta) RegLike(value, strRegexp string) string {
+	return fmt.Sprintf("%s REGEXP %s", value, strRegexp)
+}
+func (s *sqliteMeta) StringCat(values ...string) string {
+	return strings.Join(values, " || ")
+}
+
+//query the pragma statement,return every row as a map
+func (s *sqliteMeta) pragma(strSql string) ([]map[string]interface{}, error) {
+	rows, err := s.DBHelper.Query(strSql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	rev := []map[string]interface{}{}
+	for rows.Next() {
+		vals, err := scanValues(rows, len(cols))
+		if err != nil {
+			return nil, err
+		}
+		line := map[string]interface{}{}
+		for i, v := range vals {
+			if bys, ok := v.([]byte); ok {
+				v = string(bys)
+			}
+			line[cols[i]] = v
+		}
+		rev = append(rev, line)
+	}
+	return rev, rows.Err()
+}
+func sqliteInt(v interface{}) int64 {
+	switch tv := v.(type) {
+	case int64:
+		return tv
+	case bool:
+		if tv {
+			return 1
+		}
+	case string:
+		i, _ := strconv.ParseInt(tv, 10, 64)
+		return i
+	}
+	return 0
+}
+func sqliteString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+func (s *sqliteMeta) ensureDescTable() error {
+	if exists, err := s.TableExists(sqliteDescTable); err != nil || exists {
+		return err
+	}
+	_, err := s.DBHelper.Exec(sqliteDescTableSql)
+	return err
+}
+func (s *sqliteMeta) getDesc(tablename, kind string) (map[string]DBDesc, error) {
+	//只读,不创建描述表
+	if exists, err := s.TableExists(sqliteDescTable); err != nil || !exists {
+		return map[string]DBDesc{}, err
+	}
+	rows, err := s.DBHelper.Query(fmt.Sprintf(
+		"SELECT name,content FROM %s WHERE tablename={{ph}} AND kind={{ph}}", sqliteDescTable), tablename, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rev := map[string]DBDesc{}
+	for rows.Next() {
+		var name, content string
+		if err := rows.Scan(&name, &content); err != nil {
+			return nil, err
+		}
+		desc := DBDesc{}
+		if err := desc.Parse(content); err != nil {
+			return nil, fmt.Errorf("the desc %q of %s %s.%s isn't valid:%s", content, kind, tablename, name, err)
+		}
+		rev[name] = desc
+	}
+	return rev, rows.Err()
+}
+//remove the desc,empty kind remove all desc of the table,empty name remove all desc of the kind
+func (s *sqliteMeta) removeDesc(tablename, kind, name string) error {
+	if err := s.ensureDescTable(); err != nil {
+		return err
+	}
+	strSql := fmt.Sprintf("DELETE FROM %s WHERE tablename={{ph}}", sqliteDescTable)
+	args := []interface{}{tablename}
+	if kind != "" {
+		strSql += " AND kind={{ph}}"
+		args = append(args, kind)
+		if name != "" {
+			strSql += " AND name={{ph}}"
+			args = append(args, name)
+		}
+	}
+	_, err := s.DBHelper.Exec(strSql, args...)
+	return err
+}
+func (s *sqliteMeta) TableExists(tablename string) (bool, error) {
+	return s.DBHelper.Exists(
+		"SELECT name FROM sqlite_master WHERE type='table' AND name={{ph}}\n"+
+			"UNION ALL\n"+
+			"SELECT name FROM sqlite_temp_master WHERE type='table' AND name={{ph}}", tablename, tablename)
+}
+func (s *sqliteMeta) isTemporary(tablename string) (bool, error) {
+	return s.DBHelper.Exists("SELECT name FROM sqlite_temp_master WHERE type='table' AND name={{ph}}", tablename)
+}
+//the table_info not return the generated column,so use the table_xinfo.
+//the check and the generated expression are parsed from the CREATE TABLE
+func (s *sqliteMeta) GetColumns(tablename string) ([]*TableColumn, error) {
+	lines, err := s.pragma(fmt.Sprintf("PRAGMA table_xinfo(%s)", tablename))
+	if err != nil {
+		return nil, err
+	}
+	descs, err := s.getDesc(tablename, sqliteDescKindColumn)
+	if err != nil {
+		return nil, err
+	}
+	strSql, err := s.createSql(tablename)
+	if err != nil {
+		return nil, err
+	}
+	defines := sqliteColumnDefines(strSql)
+	pkCount := 0
+	for _, line := range lines {
+		if sqliteInt(line["pk"]) > 0 {
+			pkCount++
+		}
+	}
+	rev := []*TableColumn{}
+	for _, line := range lines {
+		//虚拟表的隐藏列
+		if sqliteInt(line["hidden"]) == 1 {
+			continue
+		}
+		name := sqliteString(line["name"])
+		dbType := sqliteString(line["type"])
+		colType, maxSize := sqliteParseType(dbType)
+		desc, ok := descs[name]
+		if !ok {
+			desc = DBDesc{}
+		}
+		col := &TableColumn{Name: name, Type: colType, MaxSize: maxSize, NotNull: sqliteInt(line["notnull"]) != 0, Desc: desc,
+			Default: sqliteString(line["dflt_value"])}
+		if colType == datatable.Float64 {
+			col.Precision, col.Scale, _ = parseNumericType(dbType)
+		}
+		define := defines[strings.ToLower(name)]
+		col.Check = sqliteParenExpr(define, sqliteCheckRegexp)
+		col.Computed = sqliteParenExpr(define, sqliteGeneratedRegexp)
+		//INTEGER PRIMARY KEY是rowid的别名,插入NULL时自动生成
+		if pkCount == 1 && sqliteInt(line["pk"]) > 0 && strings.EqualFold(dbType, "INTEGER") {
+			col.Desc[DescGenerated] = true
+		}
+		rev = append(rev, col)
+	}
+	return rev, nil
+}
+
+//the CREATE TABLE of the table
+func (s *sqliteMeta) createSql(tablename string) (string, error) {
+	var strSql string
+	err := s.DBHelper.QueryRow(
+		"SELECT sql FROM sqlite_master WHERE type='table' AND name={{ph}}\n"+
+			"UNION ALL\n"+
+			"SELECT sql FROM sqlite_temp_master WHERE type='table' AND name={{ph}}", tablename, tablename).Scan(&strSql)
+	return strSql, err
+}
+
+//split the column defines of the CREATE TABLE,the key is the lower column name
+func sqliteColumnDefines(strSql string) map[string]string {
+	rev := map[string]string{}
+	begin := strings.Index(strSql, "(")
+	if begin < 0 {
+		return rev
+	}
+	end := matchedParen(strSql, begin)
+	if end < 0 {
+		return rev
+	}
+	body := strSql[begin+1 : end]
+	depth, inString, last := 0, false, 0
+	parts := []string{}
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c == '\'':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, body[last:i])
+			last = i + 1
+		}
+	}
+	parts = append(parts, body[last:])
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" || sqliteConstraintRegexp.MatchString(part) {
+			continue
+		}
+		name := strings.Fields(part)[0]
+		rev[strings.ToLower(strings.Trim(name, "\"`[]"))] = part
+	}
+	return rev
+}
+
+//the expression in the parentheses after the keyword,empty if not found
+func sqliteParenExpr(define string, keyword *regexp.Regexp) string {
+	loc := keyword.FindStringIndex(define)
+	if loc == nil {
+		return ""
+	}
+	end := matchedParen(define, loc[1]-1)
+	if end < 0 {
+		return ""
+	}
+	return strings.TrimSpace(define[loc[1]:end])
+}
+func sqliteColumnDefine(col *TableColumn) (string, error) {
+	dbType, err := columnDBType(col, sqliteDBType)
+	if err != nil {
+		return "", err
+	}
+	rev := col.Name + " " + dbType
+	if col.NotNull {
+		rev += " NOT NULL"
+	}
+	if col.Computed != "" {
+		rev += fmt.Sprintf(" GENERATED ALWAYS AS (%s) STORED", col.Computed)
+	} else if col.Default != "" {
+		rev += " DEFAULT " + col.Default
+	}
+	if col.Check != "" {
+		rev += fmt.Sprintf(" CHECK (%s)", col.Check)
+	}
+	return rev, nil
+}
+func (s *sqliteMeta) GetPrimaryKeys(tablename string) ([]string, error) {
+	lines, err := s.pragma(fmt.Sprintf("PRAGMA table_info(%s)", tablename))
+	if err != nil {
+		return nil, err
+	}
+	pkLines := []map[string]interface{}{}
+	for _, line := range lines {
+		if sqliteInt(line["pk"]) > 0 {
+			pkLines = append(pkLines, line)
+		}
+	}
+	//pk字段保存的是在主键中的顺序
+	sort.Slice(pkLines, func(i, j int) bool {
+		return sqliteInt(pkLines[i]["pk"]) < sqliteInt(pkLines[j]["pk"])
+	})
+	rev := make([]string, len(pkLines))
+	for i, line := range pkLines {
+		rev[i] = sqliteString(line["name"])
+	}
+	return rev, nil
+}
+func (s *sqliteMeta) GetIndexes(tablename string) ([]*TableIndex, error) {
+	lines, err := s.pragma(fmt.Sprintf("PRAGMA index_list(%s)", tablename))
+	if err != nil {
+		return nil, err
+	}
+	descs, err := s.getDesc(tablename, sqliteDescKindIndex)
+	if err != nil {
+		return nil, err
+	}
+	rev := []*TableIndex{}
+	for _, line := range lines {
+		name := sqliteString(line["name"])
+		//跳过主键及唯一约束自动创建的索引
+		if origin, ok := line["origin"]; ok && sqliteString(origin) != "c" {
+			continue
+		}
+		if strings.HasPrefix(name, "sqlite_autoindex_") {
+			continue
+		}
+		cols, err := s.pragma(fmt.Sprintf("PRAGMA index_info(%s)", name))
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(cols, func(i, j int) bool {
+			return sqliteInt(cols[i]["seqno"]) < sqliteInt(cols[j]["seqno"])
+		})
+		colNames := make([]string, len(cols))
+		for i, col := range cols {
+			colNames[i] = sqliteString(col["name"])
+		}
+		desc, ok := descs[name]
+		if !ok {
+			desc = DBDesc{}
+		}
+		rev = append(rev, &TableIndex{name, colNames, sqliteInt(line["unique"]) != 0, desc})
+	}
+	return rev, nil
+}
+//the name of the foreign keys parsed from the CREATE TABLE,the key is the columns
+func (s *sqliteMeta) foreignKeyNames(tablename string) (map[string]string, error) {
+	strSql, err := s.createSql(tablename)
+	if err != nil {
+		return nil, err
+	}
+	rev := map[string]string{}
+	for _, m := range sqliteFKRegexp.FindAllStringSubmatch(strSql, -1) {
+		rev[sqliteColumnsKey(strings.Split(m[2], ","))] = m[1]
+	}
+	return rev, nil
+}
+func sqliteColumnsKey(cols []string) string {
+	rev := make([]string, len(cols))
+	for i, c := range cols {
+		rev[i] = strings.ToLower(strings.TrimSpace(c))
+	}
+	return strings.Join(rev, ",")
+}
+
+//pragma not return the name of the foreign key,parse it from the CREATE TABLE,
+//named by the table and the id if not found
+func (s *sqliteMeta) GetForeignKeys(tablename string) ([]*TableForeignKey, error) {
+	lines, err := s.pragma(fmt.Sprintf("PRAGMA foreign_key_list(%s)", tablename))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return []*TableForeignKey{}, nil
+	}
+	names, err := s.foreignKeyNames(tablename)
+	if err != nil {
+		return nil, err
+	}
+	descs, err := s.getDesc(tablename, sqliteDescKindFK)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if sqliteInt(lines[i]["id"]) != sqliteInt(lines[j]["id"]) {
+			return sqliteInt(lines[i]["id"]) < sqliteInt(lines[j]["id"])
+		}
+		return sqliteInt(lines[i]["seq"]) < sqliteInt(lines[j]["seq"])
+	})
+	rev := []*TableForeignKey{}
+	var last *TableForeignKey
+	lastID := int64(-1)
+	for _, line := range lines {
+		if id := sqliteInt(line["id"]); last == nil || id != lastID {
+			lastID = id
+			last = &TableForeignKey{
+				RefTable: sqliteString(line["table"]),
+				OnDelete: foreignKeyAction(sqliteString(line["on_delete"])),
+				OnUpdate: foreignKeyAction(sqliteString(line["on_update"])),
+			}
+			rev = append(rev, last)
+		}
+		last.Columns = append(last.Columns, sqliteString(line["from"]))
+		last.RefColumns = append(last.RefColumns, sqliteString(line["to"]))
+	}
+	for i, fk := range rev {
+		var ok bool
+		if fk.Name, ok = names[sqliteColumnsKey(fk.Columns)]; !ok {
+			fk.Name = fmt.Sprintf("fk_%s_%d", tablename, i)
+		}
+		if fk.Desc, ok = descs[fk.Name]; !ok {
+			fk.Desc = DBDesc{}
+		}
+	}
+	return rev, nil
+}
+func (s *sqliteMeta) AddForeignKey(tablename string, fk *TableForeignKey) error {
+	return s.execDDL(&SchemaChange{Op: OpAddForeignKey, TableName: tablename, Name: fk.Name, ForeignKey: fk})
+}
+func (s *sqliteMeta) DropForeignKey(tablename, fkname string) error {
+	return s.execDDL(&SchemaChange{Op: OpDropForeignKey, TableName: tablename, Name: fkname})
+}
+func (s *sqliteMeta) GetTableDesc(tablename string) (DBDesc, error) {
+	descs, err := s.getDesc(tablename, sqliteDescKindTable)
+	if err != nil {
+		return nil, err
+	}
+	if desc, ok := descs[""]; ok {
+		return desc, nil
+	}
+	return DBDesc{}, nil
+}
+func (s *sqliteMeta) AlterTableDesc(tablename string, desc DBDesc) error {
+	return s.execDDL(&SchemaChange{Op: OpAlterTableDesc, TableName: tablename, Desc: desc})
+}
+func (s *sqliteMeta) DropTable(tablename string) error {
+	return s.inTrans(func(s *sqliteMeta) error {
+		if err := s.RootMeta.DropTable(tablename); err != nil {
+			return err
+		}
+		return s.removeDesc(tablename, "", "")
+	})
+}
+func (s *sqliteMeta) createTableSql(table *sqliteTable) (string, error) {
+	lines := []string{}
+	for _, col := range table.columns {
+		line, err := sqliteColumnDefine(col)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	if len(table.pks) > 0 {
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY(%s)", strings.Join(table.pks, ",")))
+	}
+	for _, fk := range table.foreignKeys {
+		lines = append(lines, fmt.Sprintf("CONSTRAINT %s %s", fk.Name, foreignKeyClause(fk)))
+	}
+	strTemp := ""
+	if table.temporary {
+		strTemp = "TEMPORARY "
+	}
+	return fmt.Sprintf("CREATE %sTABLE %s(\n\t%s)", strTemp, table.name, strings.Join(lines, ",\n\t")), nil
+}
+
+func (s *sqliteMeta) CreateTable(table *DataTable) error {
+	return s.execDDL(&SchemaChange{Op: OpCreateTable, TableName: table.TableName, Table: table})
+}
+
+//load the table struct from database
+func (s *sqliteMeta) loadTable(tablename string) (*sqliteTable, error) {
+	var err error
+	rev := &sqliteTable{name: tablename}
+	if rev.temporary, err = s.isTemporary(tablename); err != nil {
+		return nil, err
+	}
+	if rev.columns, err = s.GetColumns(tablename); err != nil {
+		return nil, err
+	}
+	if rev.pks, err = s.GetPrimaryKeys(tablename); err != nil {
+		return nil, err
+	}
+	if rev.indexes, err = s.GetIndexes(tablename); err != nil {
+		return nil, err
+	}
+	if rev.foreignKeys, err = s.GetForeignKeys(tablename); err != nil {
+		return nil, err
+	}
+	if rev.desc, err = s.GetTableDesc(tablename); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+//all column name map to self
+func sqliteSameColumns(columns []*TableColumn) map[string]string {
+	rev := map[string]string{}
+	for _, col := range columns {
+		rev[col.Name] = col.Name
+	}
+	return rev
+}
+func (s *sqliteMeta) DropPrimaryKey(tablename string) error {
+	return s.execDDL(&SchemaChange{Op: OpDropPrimaryKey, TableName: tablename})
+}
+func (s *sqliteMeta) AddPrimaryKey(tablename string, pks []string) error {
+	return s.execDDL(&SchemaChange{Op: OpAddPrimaryKey, TableName: tablename, PK: pks})
+}
+func (s *sqliteMeta) DropColumn(tablename, column string) error {
+	return s.execDDL(&SchemaChange{Op: OpDropColumn, TableName: tablename, Name: column})
+}
+func (s *sqliteMeta) AddColumn(tablename string, column *TableColumn) error {
+	return s.execDDL(&SchemaChange{Op: OpAddColumn, TableName: tablename, Name: column.Name, Column: column})
+}
+func (s *sqliteMeta) AlterColumn(tablename string, oldColumn, newColumn *TableColumn) error {
+	return s.execDDL(&SchemaChange{Op: OpAlterColumn, TableName: tablename, Name: newColumn.Name,
+		OldColumn: oldColumn, Column: newColumn})
+}
+func (s *sqliteMeta) CreateIndex(tableName, indexName string, columns []string, unique bool, desc DBDesc) error {
+	return s.execDDL(&SchemaChange{Op: OpCreateIndex, TableName: tableName, Name: indexName,
+		Index: &Index{columns, unique, desc}})
+}
+func (s *sqliteMeta) DropIndex(tablename, indexname string) error {
+	return s.execDDL(&SchemaChange{Op: OpDropIndex, TableName: tablename, Name: indexname})
+}
+func (s *sqliteMeta) AlterIndex(tablename, indexname string, oldIndex, newIndex *Index) error {
+	return s.execDDL(&SchemaChange{Op: OpAlterIndex, TableName: tablename, Name: indexname, OldIndex: oldIndex, Index: newIndex})
+}
+
+//the change need rebuild the table
+func sqliteNeedRebuild(c *SchemaChange) bool {
+	switch c.Op {
+	case OpDropForeignKey, OpDropPrimaryKey, OpDropColumn, OpAddPrimaryKey, OpAddForeignKey:
+		return true
+	case OpAddColumn:
+		return sqliteAddColumnRebuild(c.Column)
+	case OpAlterColumn:
+		return !c.OldColumn.DefineEqual(c.Column)
+	}
+	return false
+}
+
+//sqlite的not null字段新增时必须有缺省值,缺省值必须是常量,不能新增stored计算列,所以重建表
+func sqliteAddColumnRebuild(column *TableColumn) bool {
+	return column.NotNull || column.Default != "" || column.Computed != ""
+}
+
+//build and execute the statements of the change,the rebuild run with the foreign_keys off
+func (s *sqliteMeta) execDDL(change *SchemaChange) error {
+	fn := func(s *sqliteMeta) error {
+		return execDDL(s.DBHelper, s, change)
+	}
+	if sqliteNeedRebuild(change) {
+		return s.inDDLTrans(change.TableName, fn)
+	}
+	return s.inTrans(fn)
+}
+
+//the changes are built on the struct changed by the previous changes(sqlite rebuild the whole table)
+func (s *sqliteMeta) BuildDDL(changes []*SchemaChange) ([][]string, error) {
+	d := &sqliteDDL{s: s, tables: map[string]*sqliteTable{}}
+	rev := make([][]string, len(changes))
+	for i, c := range changes {
+		var err error
+		if rev[i], err = d.build(c); err != nil {
+			return nil, err
+		}
+	}
+	return rev, nil
+}
+
+//sqliteDDL build the statements of the changes,the table struct is loaded at the first change of the table
+//and kept changed by the later changes,the database isn't changed
+type sqliteDDL struct {
+	s           *sqliteMeta
+	tables      map[string]*sqliteTable
+	descChecked bool
+	descExists  bool
+}
+
+func (d *sqliteDDL) table(tablename string) (*sqliteTable, error) {
+	if t, ok := d.tables[tablename]; ok {
+		return t, nil
+	}
+	t, err := d.s.loadTable(tablename)
+	if err != nil {
+		return nil, err
+	}
+	d.tables[tablename] = t
+	return t, nil
+}
+func (d *sqliteDDL) descTableExists() (bool, error) {
+	if !d.descChecked {
+		exists, err := d.s.TableExists(sqliteDescTable)
+		if err != nil {
+			return false, err
+		}
+		d.descChecked, d.descExists = true, exists
+	}
+	return d.descExists, nil
+}
+
+//remove the desc,empty kind remove all desc of the table,empty name remove all desc of the kinds
+func (d *sqliteDDL) removeDescSql(tablename, name string, kinds ...string) ([]string, error) {
+	if exists, err := d.descTableExists(); err != nil || !exists {
+		return nil, err
+	}
+	strSql := fmt.Sprintf("DELETE FROM %s WHERE tablename=%s", sqliteDescTable, d.s.StringExpress(tablename))
+	if len(kinds) > 0 {
+		list := make([]string, len(kinds))
+		for i, kind := range kinds {
+			list[i] = d.s.StringExpress(kind)
+		}
+		if len(list) == 1 {
+			strSql += " AND kind=" + list[0]
+		} else {
+			strSql += fmt.Sprintf(" AND kind IN(%s)", strings.Join(list, ","))
+		}
+		if name != "" {
+			strSql += " AND name=" + d.s.StringExpress(name)
+		}
+	}
+	return []string{strSql}, nil
+}
+
+//insert the desc,the desc table is created at the first insert
+func (d *sqliteDDL) insertDescSql(tablename, kind, name string, desc DBDesc) ([]string, error) {
+	if desc.IsEmpty() {
+		return nil, nil
+	}
+	exists, err := d.descTableExists()
+	if err != nil {
+		return nil, err
+	}
+	rev := []string{}
+	if !exists {
+		rev = append(rev, sqliteDescTableSql)
+		d.descExists = true
+	}
+	return append(rev, fmt.Sprintf("INSERT INTO %s(tablename,kind,name,content)VALUES(%s,%s,%s,%s)", sqliteDescTable,
+		d.s.StringExpress(tablename), d.s.StringExpress(kind), d.s.StringExpress(name), d.s.StringExpress(desc.String()))), nil
+}
+func (d *sqliteDDL) setDescSql(tablename, kind, name string, desc DBDesc) ([]string, error) {
+	rev, err := d.removeDescSql(tablename, name, kind)
+	if err != nil {
+		return nil, err
+	}
+	ins, err := d.insertDescSql(tablename, kind, name, desc)
+	if err != nil {
+		return nil, err
+	}
+	return append(rev, ins...), nil
+}
+func (d *sqliteDDL) createIndexSql(tableName, indexName string, columns []string, unique bool, desc DBDesc) ([]string, error) {
+	strUnique := ""
+	if unique {
+		strUnique = "UNIQUE "
+	}
+	rev := []string{fmt.Sprintf("CREATE %sINDEX %s ON %s(%s)", strUnique, indexName, tableName, strings.Join(columns, ","))}
+	descs, err := d.setDescSql(tableName, sqliteDescKindIndex, indexName, desc)
+	if err != nil {
+		return nil, err
+	}
+	return append(rev, descs...), nil
+}
+
+//the desc of the indexes,columns and foreign keys of the table
+func (d *sqliteDDL) tableDescSql(t *sqliteTable) ([]string, error) {
+	rev := []string{}
+	add := func(kind, name string, desc DBDesc) error {
+		descs, err := d.insertDescSql(t.name, kind, name, desc)
+		rev = append(rev, descs...)
+		return err
+	}
+	for _, col := range t.columns {
+		if err := add(sqliteDescKindColumn, col.Name, col.storedDesc()); err != nil {
+			return nil, err
+		}
+	}
+	for _, fk := range t.foreignKeys {
+		if err := add(sqliteDescKindFK, fk.Name, fk.Desc); err != nil {
+			return nil, err
+		}
+	}
+	return rev, nil
+}
+
+//create the table,the indexes and save the desc
+func (d *sqliteDDL) createSql(t *sqliteTable) ([]string, error) {
+	strSql, err := d.s.createTableSql(t)
+	if err != nil {
+		return nil, err
+	}
+	rev := []string{strSql}
+	//清除同名旧表残留的描述
+	descs, err := d.removeDescSql(t.name, "")
+	if err != nil {
+		return nil, err
+	}
+	rev = append(rev, descs...)
+	for _, idx := range t.indexes {
+		if descs, err = d.createIndexSql(t.name, idx.Name, idx.Columns, idx.Unique, idx.Desc); err != nil {
+			return nil, err
+		}
+		rev = append(rev, descs...)
+	}
+	if descs, err = d.tableDescSql(t); err != nil {
+		return nil, err
+	}
+	rev = append(rev, descs...)
+	if descs, err = d.insertDescSql(t.name, sqliteDescKindTable, "", t.desc); err != nil {
+		return nil, err
+	}
+	return append(rev, descs...), nil
+}
+
+//sqlite不支持修改字段及主键,只能重建表.
+//t is the new struct of the table,colMap is the new column name --> old column name,
+//the new column not in the map will be not copy data
+func (d *sqliteDDL) rebuildSql(t *sqliteTable, colMap map[string]string) ([]string, error) {
+	tmp := *t
+	tmp.name = t.name + "_dbhelper_rebuild"
+	strSql, err := d.s.createTableSql(&tmp)
+	if err != nil {
+		return nil, err
+	}
+	rev := []string{strSql}
+	newCols := []string{}
+	oldCols := []string{}
+	for _, col := range t.columns {
+		//计算列不能插入
+		if col.Computed != "" {
+			continue
+		}
+		if oldName, ok := colMap[col.Name]; ok {
+			newCols = append(newCols, col.Name)
+			oldCols = append(oldCols, oldName)
+		}
+	}
+	if len(newCols) > 0 {
+		rev = append(rev, fmt.Sprintf("INSERT INTO %s(%s)\nSELECT %s FROM %s",
+			tmp.name, strings.Join(newCols, ","), strings.Join(oldCols, ","), t.name))
+	}
+	//删除旧表时索引一并删除
+	rev = append(rev, fmt.Sprintf("DROP TABLE %s", t.name),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tmp.name, t.name))
+	descs, err := d.removeDescSql(t.name, "", sqliteDescKindColumn, sqliteDescKindIndex, sqliteDescKindFK)
+	if err != nil {
+		return nil, err
+	}
+	rev = append(rev, descs...)
+	for _, idx := range t.indexes {
+		if descs, err = d.createIndexSql(t.name, idx.Name, idx.Columns, idx.Unique, idx.Desc); err != nil {
+			return nil, err
+		}
+		rev = append(rev, descs...)
+	}
+	if descs, err = d.tableDescSql(t); err != nil {
+		return nil, err
+	}
+	d.tables[t.name] = t
+	return append(rev, descs...), nil
+}
+
+//replace the column name in the names,return a new slice
+func sqliteRenameColumn(names []string, oldName, newName string) []string {
+	rev := make([]string, len(names))
+	for i, name := range names {
+		if name == oldName {
+			name = newName
+		}
+		rev[i] = name
+	}
+	return rev
+}
+func sqliteContains(names []string, name string) bool {
+	for _, v := range names {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+func (d *sqliteDDL) build(c *SchemaChange) ([]string, error) {
+	if c.Op == OpCreateTable {
+		t := &sqliteTable{
+			name:        c.Table.TableName,
+			temporary:   c.Table.Temporary,
+			columns:     tableColumns(c.Table),
+			pks:         c.Table.PK,
+			indexes:     tableIndexes(c.Table),
+			foreignKeys: tableForeignKeys(c.Table),
+			desc:        c.Table.Desc,
+		}
+		d.tables[t.name] = t
+		return d.createSql(t)
+	}
+	old, err := d.table(c.TableName)
+	if err != nil {
+		return nil, err
+	}
+	//修改的是副本,不改变已构建的语句所基于的表结构
+	t := *old
+	switch c.Op {
+	case OpDropForeignKey:
+		t.foreignKeys = []*TableForeignKey{}
+		for _, fk := range old.foreignKeys {
+			if fk.Name != c.Name {
+				t.foreignKeys = append(t.foreignKeys, fk)
+			}
+		}
+		return d.rebuildSql(&t, sqliteSameColumns(t.columns))
+	case OpAddForeignKey:
+		t.foreignKeys = append(append([]*TableForeignKey{}, old.foreignKeys...), c.ForeignKey)
+		return d.rebuildSql(&t, sqliteSameColumns(t.columns))
+	case OpDropPrimaryKey:
+		t.pks = nil
+		return d.rebuildSql(&t, sqliteSameColumns(t.columns))
+	case OpAddPrimaryKey:
+		t.pks = c.PK
+		return d.rebuildSql(&t, sqliteSameColumns(t.columns))
+	case OpDropColumn:
+		t.columns = []*TableColumn{}
+		for _, col := range old.columns {
+			if col.Name != c.Name {
+				t.columns = append(t.columns, col)
+			}
+		}
+		t.pks = []string{}
+		for _, pk := range old.pks {
+			if pk != c.Name {
+				t.pks = append(t.pks, pk)
+			}
+		}
+		//包含该字段的索引一并删除
+		t.indexes = []*TableIndex{}
+		for _, idx := range old.indexes {
+			if !sqliteContains(idx.Columns, c.Name) {
+				t.indexes = append(t.indexes, idx)
+			}
+		}
+		//包含该字段的外键一并删除
+		t.foreignKeys = []*TableForeignKey{}
+		for _, fk := range old.foreignKeys {
+			if !sqliteContains(fk.Columns, c.Name) {
+				t.foreignKeys = append(t.foreignKeys, fk)
+			}
+		}
+		return d.rebuildSql(&t, sqliteSameColumns(t.columns))
+	case OpAddColumn:
+		colMap := sqliteSameColumns(old.columns)
+		t.columns = append(append([]*TableColumn{}, old.columns...), c.Column)
+		if sqliteAddColumnRebuild(c.Column) {
+			return d.rebuildSql(&t, colMap)
+		}
+		define, err := sqliteColumnDefine(c.Column)
+		if err != nil {
+			return nil, err
+		}
+		d.tables[t.name] = &t
+		descs, err := d.setDescSql(t.name, sqliteDescKindColumn, c.Column.Name, c.Column.storedDesc())
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", t.name, define)}, descs...), nil
+	case OpAlterColumn:
+		t.columns = make([]*TableColumn, len(old.columns))
+		colMap := map[string]string{}
+		for i, col := range old.columns {
+			if col.Name == c.OldColumn.Name {
+				t.columns[i] = c.Column
+				colMap[c.Column.Name] = c.OldColumn.Name
+			} else {
+				t.columns[i] = col
+				colMap[col.Name] = col.Name
+			}
+		}
+		if c.OldColumn.DefineEqual(c.Column) {
+			d.tables[t.name] = &t
+			if c.OldColumn.storedDesc().Equal(c.Column.storedDesc()) {
+				return []string{}, nil
+			}
+			return d.setDescSql(t.name, sqliteDescKindColumn, c.Column.Name, c.Column.storedDesc())
+		}
+		t.pks = sqliteRenameColumn(old.pks, c.OldColumn.Name, c.Column.Name)
+		t.indexes = make([]*TableIndex, len(old.indexes))
+		for i, idx := range old.indexes {
+			t.indexes[i] = &TableIndex{idx.Name, sqliteRenameColumn(idx.Columns, c.OldColumn.Name, c.Column.Name), idx.Unique, idx.Desc}
+		}
+		t.foreignKeys = make([]*TableForeignKey, len(old.foreignKeys))
+		for i, fk := range old.foreignKeys {
+			nfk := *fk
+			nfk.Columns = sqliteRenameColumn(fk.Columns, c.OldColumn.Name, c.Column.Name)
+			t.foreignKeys[i] = &nfk
+		}
+		return d.rebuildSql(&t, colMap)
+	case OpCreateIndex:
+		t.indexes = append(append([]*TableIndex{}, old.indexes...), &TableIndex{c.Name, c.Index.Columns, c.Index.Unique, c.Index.Desc})
+		d.tables[t.name] = &t
+		return d.createIndexSql(t.name, c.Name, c.Index.Columns, c.Index.Unique, c.Index.Desc)
+	case OpDropIndex, OpAlterIndex:
+		t.indexes = []*TableIndex{}
+		for _, idx := range old.indexes {
+			if idx.Name != c.Name {
+				t.indexes = append(t.indexes, idx)
+			}
+		}
+		if c.Op == OpAlterIndex {
+			t.indexes = append(t.indexes, &TableIndex{c.Name, c.Index.Columns, c.Index.Unique, c.Index.Desc})
+		}
+		d.tables[t.name] = &t
+		if c.Op == OpAlterIndex && reflect.DeepEqual(c.OldIndex.Columns, c.Index.Columns) && c.OldIndex.Unique == c.Index.Unique {
+			return d.setDescSql(t.name, sqliteDescKindIndex, c.Name, c.Index.Desc)
+		}
+		descs, err := d.removeDescSql(t.name, c.Name, sqliteDescKindIndex)
+		if err != nil {
+			return nil, err
+		}
+		rev := append([]string{fmt.Sprintf("DROP INDEX %s", c.Name)}, descs...)
+		if c.Op == OpDropIndex {
+			return rev, nil
+		}
+		creates, err := d.createIndexSql(t.name, c.Name, c.Index.Columns, c.Index.Unique, c.Index.Desc)
+		if err != nil {
+			return nil, err
+		}
+		return append(rev, creates...), nil
+	case OpAlterTableDesc:
+		t.desc = c.Desc
+		d.tables[t.name] = &t
+		return d.setDescSql(t.name, sqliteDescKindTable, "", c.Desc)
+	}
+	return nil, fmt.Errorf("the op %q not support by sqlite", c.Op)
+}
+
+//merge the source rows into dest,sqlWhere filter the source rows.
+//autoRemove will delete the dest rows that not in the source
+func (s *sqliteMeta) Merge(dest, source string, colNames []string, pkColumns []string, autoUpdate, autoRemove bool, sqlWhere string) error {
+	if len(pkColumns) == 0 {
+		return fmt.Errorf("the merge primary key is empty")
+	}
+	if sqlWhere == "" {
+		//sqlite需要where子句来避免on conflict的解析歧义
+		sqlWhere = "1=1"
+	}
+	strInsert := fmt.Sprintf("INSERT INTO %s(%s)\nSELECT %s FROM %s src WHERE %s\n%s",
+		dest, strings.Join(colNames, ","), strings.Join(colNames, ","), source, sqlWhere, onConflictClause(colNames, pkColumns, autoUpdate))
+	return s.inTrans(func(s *sqliteMeta) error {
+		if autoRemove {
+			joins := make([]string, len(pkColumns))
+			for i, pk := range pkColumns {
+				joins[i] = fmt.Sprintf("src.%s = %s.%s", pk, dest, pk)
+			}
+			if _, err := s.DBHelper.Exec(fmt.Sprintf("DELETE FROM %s WHERE NOT EXISTS(\n\tSELECT 1 FROM %s src WHERE %s AND (%s))",
+				dest, source, strings.Join(joins, " AND "), sqlWhere)); err != nil {
+				return err
+			}
+		}
+		_, err := s.DBHelper.Exec(strInsert)
+		return err
+	})
+}
+func (s *sqliteMeta) TransactionalDDL() bool {
+	return true
+}
+
+//SQLITE_MAX_VARIABLE_NUMBER of the sqlite before 3.32
+func (s *sqliteMeta) MaxParams() int {
+	return 999
+}
+func (s *sqliteMeta) NullSafeEqual(column, placeholder string) string {
+	return fmt.Sprintf("%s IS %s", column, placeholder)
+}
+//the RETURNING need the sqlite 3.35+
+func (s *sqliteMeta) BuildInsertReturningSql(tablename string, cols, returnCols []string) string {
+	return insertReturningSql(tablename, cols, returnCols)
+}
+func (s *sqliteMeta) BuildUpsertSql(tablename string, cols, pkColumns []string) string {
+	return fmt.Sprintf("INSERT INTO %s(%s)VALUES(%s)\n%s",
+		tablename, strings.Join(cols, ","), valuesPlaceholder(len(cols)), onConflictClause(cols, pkColumns, true))
+}
+
+func (s *sqliteMeta) ClassifyError(err error) ErrorKind {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "UNIQUE constraint failed"):
+		return ErrorUniqueViolation
+	case strings.Contains(msg, "FOREIGN KEY constraint failed"):
+		return ErrorForeignKeyViolation
+	case strings.Contains(msg, "NOT NULL constraint failed"):
+		return ErrorNotNullViolation
+	case strings.Contains(msg, "CHECK constraint failed"):
+		return ErrorCheckViolation
+	//SQLITE_BUSY,SQLITE_LOCKED
+	case strings.Contains(msg, "database is locked"), strings.Contains(msg, "database table is locked"):
+		return ErrorLockTimeout
+	}
+	return ErrorUnknown
+}
+
+//run fn in a transaction,the sqliteMeta passed to fn is bind to the transaction
+func (s *sqliteMeta) inTrans(fn func(s *sqliteMeta) error) error {
+	return s.RootMeta.inTrans(func(h *DBHelper) error {
+		tm := *s
+		tm.DBHelper = h
+		return fn(&tm)
+	})
+}
+
+//like the inTrans,but the foreign_keys is off,used by the rebuild
+func (s *sqliteMeta) inDDLTrans(tablename string, fn func(s *sqliteMeta) error) error {
+	return s.inDDLTx(tablename, func(h *DBHelper) error {
+		tm := *s
+		tm.DBHelper = h
+		return fn(&tm)
+	})
+}
+
+//run fn in the transaction with the foreign_keys off(the 12 steps of the sqlite's ALTER TABLE),otherwise the DROP TABLE
+//of the rebuild is an implicit DELETE,the CASCADE or SET NULL of the child tables change the data and the RESTRICT fail.
+//the foreign_keys can't be changed in the transaction,so it's turned off on a dedicated connection before BEGIN,
+//the PRAGMA foreign_key_check run before COMMIT and the foreign_keys is restored at last.
+//if already in a transaction with the foreign_keys on,the check is deferred to the commit by the defer_foreign_keys,
+//and fail if the child table has the delete action other than NO ACTION
+func (s *sqliteMeta) inDDLTx(tablename string, fn func(h *DBHelper) error) (err error) {
+	h := s.DBHelper
+	if h.db == nil {
+		return ErrNotOpen
+	}
+	ctx := h.context()
+	if h.tx != nil {
+		var fkOn bool
+		if err = h.tx.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&fkOn); err != nil {
+			return err
+		}
+		if fkOn {
+			children, err := s.deleteActionChildren(tablename)
+			if err != nil {
+				return err
+			}
+			if len(children) > 0 {
+				return fmt.Errorf("the table %s is referenced by %s with the delete action,can't be rebuilt in the transaction with the foreign_keys on",
+					tablename, strings.Join(children, ","))
+			}
+			if err = h.execTx(ctx, "PRAGMA defer_foreign_keys=ON"); err != nil {
+				return err
+			}
+		}
+		return h.InTx(fn, nil)
+	}
+	conn, err := h.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var fkOn bool
+	if err = conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&fkOn); err != nil {
+		return err
+	}
+	if fkOn {
+		if _, err = conn.ExecContext(ctx, "PRAGMA foreign_keys=OFF"); err != nil {
+			return err
+		}
+		defer func() {
+			//ctx可能已取消,仍需恢复
+			if _, rerr := conn.ExecContext(context.Background(), "PRAGMA foreign_keys=ON"); rerr != nil && err == nil {
+				err = rerr
+			}
+		}()
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	th := h.txHelper(tx, "", 0)
+	if err = fn(th); err == nil {
+		tm := *s
+		tm.DBHelper = th
+		err = tm.foreignKeyCheck()
+	}
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
+			err = fmt.Errorf("%v,and rollback fail:%v", err, rerr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+//the PRAGMA foreign_key_check,error if any row violate the foreign key
+func (s *sqliteMeta) foreignKeyCheck() error {
+	lines, err := s.pragma("PRAGMA foreign_key_check")
+	if err != nil || len(lines) == 0 {
+		return err
+	}
+	line := lines[0]
+	return fmt.Errorf("the foreign key check fail,%d rows violate the foreign key,the first is the rowid %v of %s reference %s",
+		len(lines), line["rowid"], line["table"], line["parent"])
+}
+
+//the tables reference the table with the delete action other than NO ACTION
+func (s *sqliteMeta) deleteActionChildren(tablename string) ([]string, error) {
+	lines, err := s.pragma("SELECT name FROM sqlite_master WHERE type='table'")
+	if err != nil {
+		return nil, err
+	}
+	rev := []string{}
+	for _, line := range lines {
+		name := sqliteString(line["name"])
+		fks, err := s.pragma(fmt.Sprintf("PRAGMA foreign_key_list(%s)", name))
+		if err != nil {
+			return nil, err
+		}
+		for _, fk := range fks {
+			if strings.EqualFold(sqliteString(fk["table"]), tablename) &&
+				!strings.EqualFold(sqliteString(fk["on_delete"]), "NO ACTION") {
+				rev = append(rev, name)
+				break
+			}
+		}
+	}
+	return rev, nil
+}
@@ -0,0 +1,125 @@
+//go:build sqlite
+// +build sqlite
+
+//the tests run on a real sqlite db:go test -tags sqlite
+package dbhelper
+
+import (
+	"github.com/linlexing/datatable.go"
+	_ "github.com/mattn/go-sqlite3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//the DBHelper of a sqlite db file,the :memory: db isn't shared by the connections of the pool
+func sqliteOpen(t *testing.T) (*DBHelper, func()) {
+	dir, err := ioutil.TempDir("", "dbhelper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewDBHelper("sqlite3", filepath.Join(dir, "test.db")+"?_foreign_keys=1")
+	if err = h.Open(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return h, func() {
+		h.Close()
+		os.RemoveAll(dir)
+	}
+}
+func sqliteOrders() *DataTable {
+	table := NewDataTable("orders")
+	table.AddColumn(NewDataColumn("id", datatable.Int64, 0, true))
+	table.AddColumn(NewDataColumn("name", datatable.String, 50, false))
+	table.SetPK("id")
+	table.AddIndex("idx_orders_name", &Index{[]string{"name"}, false, DBDesc{"label": "name"}})
+	table.Desc = DBDesc{"label": "orders"}
+	return table
+}
+func sqliteOrderName(t *testing.T, h *DBHelper, id int64) string {
+	var name string
+	if err := h.QueryRow("SELECT name FROM orders WHERE id={{ph}}", id).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+//CreateTable -> SaveChange -> UpdateStruct(rebuild the table) -> SaveChange
+func Test_sqliteRoundTrip(t *testing.T) {
+	h, closeFn := sqliteOpen(t)
+	defer closeFn()
+	orders := sqliteOrders()
+	if err := h.UpdateStruct(nil, orders, []string{"id", "name"}); err != nil {
+		t.Fatal(err)
+	}
+	table, err := h.Table("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table.PK, []string{"id"}) || !reflect.DeepEqual(table.ColumnNames(), []string{"id", "name"}) {
+		t.Errorf("got the pk %v,the columns %v", table.PK, table.ColumnNames())
+	}
+	if idx, ok := table.Indexes["idx_orders_name"]; !ok || !idx.Desc.Equal(DBDesc{"label": "name"}) {
+		t.Errorf("got the indexes %v", table.Indexes)
+	}
+	if !table.Desc.Equal(DBDesc{"label": "orders"}) {
+		t.Errorf("got the desc %v", table.Desc)
+	}
+
+	//新增、修改、删除
+	table.AddValues(int64(1), "a")
+	table.AddValues(int64(2), "b")
+	if n, err := h.SaveChange(table); err != nil || n != 2 {
+		t.Fatalf("got %d,%v", n, err)
+	}
+	table.AcceptChange()
+	table.SetValues(0, int64(1), "aa")
+	table.DeleteRow(1)
+	if n, err := h.SaveChange(table); err != nil || n != 2 {
+		t.Fatalf("got %d,%v", n, err)
+	}
+	table.AcceptChange()
+	if name := sqliteOrderName(t, h, 1); name != "aa" {
+		t.Errorf("got %q", name)
+	}
+	if exists, err := h.Exists("SELECT 1 FROM orders WHERE id=2"); err != nil || exists {
+		t.Errorf("the deleted row got %v,%v", exists, err)
+	}
+
+	//not null且有缺省值的字段需要重建表,数据、索引及描述保留
+	newStruct := sqliteOrders()
+	price := newStruct.AddColumn(NewDataColumn("price", datatable.Float64, 0, true))
+	price.Precision, price.Scale, price.Default = 10, 2, "0"
+	if err = h.UpdateStruct(orders, newStruct, []string{"id", "name"}); err != nil {
+		t.Fatal(err)
+	}
+	if table, err = h.Table("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table.ColumnNames(), []string{"id", "name", "price"}) {
+		t.Errorf("got the columns %v", table.ColumnNames())
+	}
+	if _, ok := table.Indexes["idx_orders_name"]; !ok {
+		t.Errorf("the index is lost after the rebuild,got %v", table.Indexes)
+	}
+	if name := sqliteOrderName(t, h, 1); name != "aa" {
+		t.Errorf("the data is lost after the rebuild,got %q", name)
+	}
+	table.AddValues(int64(3), "c", 1.5)
+	if n, err := h.SaveChange(table); err != nil || n != 1 {
+		t.Fatalf("got %d,%v", n, err)
+	}
+	var total float64
+	if err = h.QueryRow("SELECT SUM(price) FROM orders").Scan(&total); err != nil || total != 1.5 {
+		t.Errorf("got %v,%v", total, err)
+	}
+
+	//没有变化时不执行
+	plan, err := h.PlanStruct(newStruct, newStruct, nil)
+	if err != nil || !plan.IsEmpty() {
+		t.Errorf("the same struct got %v,%v", plan, err)
+	}
+}
@@ -0,0 +1,195 @@
+package dbhelper
+
+import (
+	"database/sql/driver"
+	"github.com/linlexing/datatable.go"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_sqliteParseType(t *testing.T) {
+	cases := []struct {
+		dbType  string
+		colType datatable.ColumnType
+		maxSize int
+	}{
+		{"TEXT", datatable.String, 0},
+		{"VARCHAR(20)", datatable.String, 20},
+		{"varchar( 30 )", datatable.String, 30},
+		{"INTEGER", datatable.Int64, 0},
+		{"BIGINT", datatable.Int64, 0},
+		{"REAL", datatable.Float64, 0},
+		{"DECIMAL(10,2)", datatable.Float64, 0},
+		{"DATETIME", datatable.Time, 0},
+		{"BOOLEAN", datatable.Bool, 0},
+		{"", datatable.String, 0},
+	}
+	for _, c := range cases {
+		colType, maxSize := sqliteParseType(c.dbType)
+		if colType != c.colType || maxSize != c.maxSize {
+			t.Errorf("%q parse to %v(%d),expect %v(%d)", c.dbType, colType, maxSize, c.colType, c.maxSize)
+		}
+	}
+}
+func Test_sqliteBuildUpsertSql(t *testing.T) {
+	s := &sqliteMeta{}
+	expect := "INSERT INTO t(id,name)VALUES({{ph}},{{ph}})\nON CONFLICT(id) DO UPDATE SET\n\tname = excluded.name"
+	if got := s.BuildUpsertSql("t", []string{"id", "name"}, []string{"id"}); got != expect {
+		t.Errorf("got %q,expect %q", got, expect)
+	}
+}
+func Test_sqliteBuildInsertReturningSql(t *testing.T) {
+	s := &sqliteMeta{}
+	expect := "INSERT INTO t(name)VALUES({{ph}}) RETURNING id"
+	if got := s.BuildInsertReturningSql("t", []string{"name"}, []string{"id"}); got != expect {
+		t.Errorf("got %q,expect %q", got, expect)
+	}
+	expect = "INSERT INTO t DEFAULT VALUES RETURNING id,ts"
+	if got := s.BuildInsertReturningSql("t", nil, []string{"id", "ts"}); got != expect {
+		t.Errorf("got %q,expect %q", got, expect)
+	}
+}
+
+func Test_foreignKeyClause(t *testing.T) {
+	fk := &TableForeignKey{"fk_detail_order", []string{"order_id"}, "orders", []string{"id"}, "cascade", "NO ACTION", DBDesc{}}
+	if got, expect := foreignKeyClause(fk), "FOREIGN KEY(order_id) REFERENCES orders(id) ON DELETE CASCADE"; got != expect {
+		t.Errorf("got %q,expect %q", got, expect)
+	}
+	old := &ForeignKey{[]string{"order_id"}, "orders", []string{"id"}, "CASCADE", "", nil}
+	if !old.Equal(&ForeignKey{[]string{"order_id"}, "ORDERS", []string{"id"}, "cascade", "no action", DBDesc{}}) {
+		t.Error("the foreign key should be equal")
+	}
+	if old.Equal(&ForeignKey{[]string{"order_id"}, "orders", []string{"id"}, "SET NULL", "", DBDesc{}}) {
+		t.Error("the foreign key with other action should not be equal")
+	}
+	m := sqliteFKRegexp.FindAllStringSubmatch("CREATE TABLE d(\n\tid INTEGER,\n\tCONSTRAINT fk_d FOREIGN KEY(a, b) REFERENCES m(x,y))", -1)
+	if len(m) != 1 || m[0][1] != "fk_d" || sqliteColumnsKey(strings.Split(m[0][2], ",")) != "a,b" {
+		t.Errorf("got %v", m)
+	}
+}
+
+func Test_sqliteColumnDefines(t *testing.T) {
+	defines := sqliteColumnDefines("CREATE TABLE t(\n\tid INTEGER NOT NULL,\n\tprice NUMERIC(10,2) DEFAULT 0 CHECK (price >= 0),\n" +
+		"\ttotal REAL GENERATED ALWAYS AS (price * (1 + 0.1)) STORED,\n\tname TEXT DEFAULT 'a,b',\n\tPRIMARY KEY(id))")
+	if len(defines) != 4 {
+		t.Fatalf("got %v", defines)
+	}
+	if got := sqliteParenExpr(defines["price"], sqliteCheckRegexp); got != "price >= 0" {
+		t.Errorf("got check %q", got)
+	}
+	if got := sqliteParenExpr(defines["total"], sqliteGeneratedRegexp); got != "price * (1 + 0.1)" {
+		t.Errorf("got computed %q", got)
+	}
+	if got := sqliteParenExpr(defines["name"], sqliteCheckRegexp); got != "" {
+		t.Errorf("got check %q", got)
+	}
+	define, err := sqliteColumnDefine(&TableColumn{Name: "price", Type: datatable.Float64, NotNull: true,
+		Default: "0", Check: "price >= 0", Precision: 10, Scale: 2})
+	if err != nil || define != "price NUMERIC(10,2) NOT NULL DEFAULT 0 CHECK (price >= 0)" {
+		t.Errorf("got %q,%v", define, err)
+	}
+}
+func Test_sqliteGetColumnsGenerated(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeDriverName)
+	defer h.Close()
+	fakeResult("SELECT name FROM sqlite_master WHERE type='table' AND name=?\nUNION ALL\nSELECT name FROM sqlite_temp_master WHERE type='table' AND name=?",
+		[]string{"name"})
+	fakeResult("SELECT sql FROM sqlite_master WHERE type='table' AND name=?\nUNION ALL\nSELECT sql FROM sqlite_temp_master WHERE type='table' AND name=?",
+		[]string{"sql"}, []driver.Value{"CREATE TABLE t(id INTEGER NOT NULL,code INTEGER,PRIMARY KEY(id))"})
+	xinfo := []string{"cid", "name", "type", "notnull", "dflt_value", "pk", "hidden"}
+	fakeResult("PRAGMA table_xinfo(t)", xinfo,
+		[]driver.Value{int64(0), "id", "INTEGER", int64(1), nil, int64(1), int64(0)},
+		[]driver.Value{int64(1), "code", "INTEGER", int64(0), nil, int64(0), int64(0)})
+	cols, err := h.metaHelper.GetColumns("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cols[0].Generated() || cols[1].Generated() {
+		t.Errorf("the INTEGER PRIMARY KEY should be generated only,got %v %v", cols[0].Desc, cols[1].Desc)
+	}
+	//复合主键不是rowid的别名
+	fakeResult("PRAGMA table_xinfo(t)", xinfo,
+		[]driver.Value{int64(0), "id", "INTEGER", int64(1), nil, int64(1), int64(0)},
+		[]driver.Value{int64(1), "code", "INTEGER", int64(1), nil, int64(2), int64(0)})
+	if cols, err = h.metaHelper.GetColumns("t"); err != nil {
+		t.Fatal(err)
+	}
+	if cols[0].Generated() {
+		t.Error("the column of the composite primary key isn't generated")
+	}
+}
+
+//the fake table orders(id,memo) referenced by the order_detail with ON DELETE CASCADE,the foreign_keys is on
+func fakeSqliteOrders() {
+	fakeResult("PRAGMA foreign_keys", []string{"foreign_keys"}, []driver.Value{int64(1)})
+	fakeResult("PRAGMA foreign_key_check", []string{"table", "rowid", "parent", "fkid"})
+	fakeResult("SELECT name FROM sqlite_master WHERE type='table'", []string{"name"},
+		[]driver.Value{"orders"}, []driver.Value{"order_detail"})
+	fkList := []string{"id", "seq", "table", "from", "to", "on_update", "on_delete"}
+	fakeResult("PRAGMA foreign_key_list(orders)", fkList)
+	fakeResult("PRAGMA foreign_key_list(order_detail)", fkList,
+		[]driver.Value{int64(0), int64(0), "orders", "order_id", "id", "NO ACTION", "CASCADE"})
+	fakeResult("SELECT name FROM sqlite_master WHERE type='table' AND name=?\nUNION ALL\nSELECT name FROM sqlite_temp_master WHERE type='table' AND name=?",
+		[]string{"name"})
+	fakeResult("SELECT name FROM sqlite_temp_master WHERE type='table' AND name=?", []string{"name"})
+	fakeResult("SELECT sql FROM sqlite_master WHERE type='table' AND name=?\nUNION ALL\nSELECT sql FROM sqlite_temp_master WHERE type='table' AND name=?",
+		[]string{"sql"}, []driver.Value{"CREATE TABLE orders(\n\tid INTEGER NOT NULL,\n\tmemo TEXT,\n\tPRIMARY KEY(id))"})
+	xinfo := []string{"cid", "name", "type", "notnull", "dflt_value", "pk", "hidden"}
+	fakeResult("PRAGMA table_xinfo(orders)", xinfo,
+		[]driver.Value{int64(0), "id", "INTEGER", int64(1), nil, int64(1), int64(0)},
+		[]driver.Value{int64(1), "memo", "TEXT", int64(0), nil, int64(0), int64(0)})
+	fakeResult("PRAGMA table_info(orders)", xinfo[:6],
+		[]driver.Value{int64(0), "id", "INTEGER", int64(1), nil, int64(1)},
+		[]driver.Value{int64(1), "memo", "TEXT", int64(0), nil, int64(0)})
+	fakeResult("PRAGMA index_list(orders)", []string{"seq", "name", "unique", "origin", "partial"})
+}
+func Test_sqliteRebuildForeignKeys(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := fakeOpen(t, fakeDriverName)
+	defer h.Close()
+	fakeSqliteOrders()
+	if err := h.metaHelper.DropPrimaryKey("orders"); err != nil {
+		t.Fatal(err)
+	}
+	txLog := fakeTxLog()
+	sqls, _ := fakeStatements(fakeReset())
+	//DROP TABLE前关闭foreign_keys,否则级联删除order_detail
+	if sqls[0] != "PRAGMA foreign_keys=OFF" || sqls[len(sqls)-1] != "PRAGMA foreign_keys=ON" {
+		t.Errorf("the foreign_keys isn't turned off during the rebuild,got %q", sqls)
+	}
+	if !strings.Contains(strings.Join(sqls, ";"), "DROP TABLE orders;ALTER TABLE orders_dbhelper_rebuild RENAME TO orders") {
+		t.Errorf("got %q", sqls)
+	}
+	if !reflect.DeepEqual(txLog, []string{"BEGIN", "COMMIT"}) {
+		t.Errorf("got %v", txLog)
+	}
+
+	//foreign_key_check失败时回滚,并恢复foreign_keys
+	fakeSqliteOrders()
+	fakeResult("PRAGMA foreign_key_check", []string{"table", "rowid", "parent", "fkid"},
+		[]driver.Value{"order_detail", int64(3), "orders", int64(0)})
+	if err := h.metaHelper.DropPrimaryKey("orders"); err == nil || !strings.Contains(err.Error(), "foreign key check") {
+		t.Errorf("the foreign key violation should fail,got %v", err)
+	}
+	txLog = fakeTxLog()
+	sqls, _ = fakeStatements(fakeReset())
+	if sqls[len(sqls)-1] != "PRAGMA foreign_keys=ON" || !reflect.DeepEqual(txLog, []string{"BEGIN", "ROLLBACK"}) {
+		t.Errorf("the foreign_keys isn't restored or not rollback,got %q %v", sqls, txLog)
+	}
+
+	//事务中不能关闭foreign_keys,级联的子表拒绝重建
+	fakeSqliteOrders()
+	err := h.InTx(func(th *DBHelper) error {
+		return th.metaHelper.DropPrimaryKey("orders")
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "order_detail") {
+		t.Errorf("the rebuild in the transaction should fail,got %v", err)
+	}
+	if sqls, _ = fakeStatements(fakeReset()); len(sqls) != 0 {
+		t.Errorf("got %q", sqls)
+	}
+}
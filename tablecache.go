@@ -0,0 +1,63 @@
+package dbhelper
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+//the table struct cache of the DBHelper,used by the Insert,Update,Upsert and Delete,
+//the key is the lower table name
+type tableCache struct {
+	mutex  sync.RWMutex
+	tables map[string]*DataTable
+}
+
+func newTableCache() *tableCache {
+	return &tableCache{tables: map[string]*DataTable{}}
+}
+func (c *tableCache) get(tablename string) (*DataTable, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	t, ok := c.tables[strings.ToLower(tablename)]
+	return t, ok
+}
+func (c *tableCache) set(tablename string, table *DataTable) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tables[strings.ToLower(tablename)] = table
+}
+
+//remove the tables,all if no table given
+func (c *tableCache) remove(tablenames ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(tablenames) == 0 {
+		c.tables = map[string]*DataTable{}
+		return
+	}
+	for _, name := range tablenames {
+		delete(c.tables, strings.ToLower(name))
+	}
+}
+
+//the cached table struct,read by the TableContext if not found.the table is shared,don't change it
+func (h *DBHelper) cachedTable(ctx context.Context, tablename string) (*DataTable, error) {
+	if t, ok := h.tables.get(tablename); ok {
+		return t, nil
+	}
+	//读取时不加锁,并发读取同一表只是多查一次
+	t, err := h.TableContext(ctx, tablename)
+	if err != nil {
+		return nil, err
+	}
+	h.tables.set(tablename, t)
+	return t, nil
+}
+
+//InvalidateTable remove the cached struct of the tables(all if no table given),the cache is used by the
+//Insert,Update,Upsert and Delete.the UpdateStruct,ExecutePlan and DropTable of the DBHelper invalidate the table
+//automatically,the struct changed by other way must be invalidated explicitly
+func (h *DBHelper) InvalidateTable(tablenames ...string) {
+	h.tables.remove(tablenames...)
+}
@@ -0,0 +1,209 @@
+package dbhelper
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"text/template"
+)
+
+const (
+	DefaultTemplateCacheSize = 512
+)
+
+//TemplateCacheStats is the statistics of the DBHelper's sql template cache
+type TemplateCacheStats struct {
+	Hits     int64
+	Misses   int64
+	Size     int
+	Capacity int
+	//the number of the templates registered by RegisterTemplate,they never be evicted
+	Named int
+}
+
+type templateCacheItem struct {
+	sql      string
+	template *template.Template
+}
+
+//a lru cache of the parsed sql template,key is the sql text
+type templateCache struct {
+	mutex    sync.Mutex
+	capacity int
+	lru      *list.List
+	items    map[string]*list.Element
+	pinned   map[string]*template.Template
+	names    map[string]string
+	hits     int64
+	misses   int64
+}
+
+func newTemplateCache(capacity int) *templateCache {
+	return &templateCache{
+		capacity: capacity,
+		lru:      list.New(),
+		items:    map[string]*list.Element{},
+		pinned:   map[string]*template.Template{},
+		names:    map[string]string{},
+	}
+}
+
+//get the parsed template of the sql,parse it if not found
+func (c *templateCache) get(sql string, parse func(string) (*template.Template, error)) (*template.Template, error) {
+	c.mutex.Lock()
+	if t, ok := c.pinned[sql]; ok {
+		c.hits++
+		c.mutex.Unlock()
+		return t, nil
+	}
+	if e, ok := c.items[sql]; ok {
+		c.hits++
+		c.lru.MoveToFront(e)
+		c.mutex.Unlock()
+		return e.Value.(*templateCacheItem).template, nil
+	}
+	c.misses++
+	c.mutex.Unlock()
+	//解析时不加锁,并发解析同一语句只是多做一次
+	t, err := parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.capacity <= 0 {
+		return t, nil
+	}
+	if e, ok := c.items[sql]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(*templateCacheItem).template, nil
+	}
+	c.items[sql] = c.lru.PushFront(&templateCacheItem{sql, t})
+	c.evict()
+	return t, nil
+}
+func (c *templateCache) evict() {
+	for c.lru.Len() > c.capacity {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.items, e.Value.(*templateCacheItem).sql)
+	}
+}
+func (c *templateCache) setCapacity(capacity int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.capacity = capacity
+	if capacity < 0 {
+		c.capacity = 0
+	}
+	c.evict()
+}
+func (c *templateCache) register(name, sql string, t *template.Template) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.names[name]; ok {
+		return fmt.Errorf("the template %q has exists", name)
+	}
+	c.names[name] = sql
+	c.pinned[sql] = t
+	return nil
+}
+func (c *templateCache) named(name string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	sql, ok := c.names[name]
+	return sql, ok
+}
+func (c *templateCache) stats() TemplateCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return TemplateCacheStats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Size:     c.lru.Len(),
+		Capacity: c.capacity,
+		Named:    len(c.names),
+	}
+}
+
+//the state of one execution of the sql template
+type templateState struct {
+	count  int
+	params map[string]interface{}
+	args   []interface{}
+	next   int
+	values []interface{}
+	named  bool
+}
+
+//the args in the order of the placeholder
+func (s *templateState) result() []interface{} {
+	if !s.named {
+		return s.args
+	}
+	if s.next < len(s.args) {
+		return append(s.values, s.args[s.next:]...)
+	}
+	return s.values
+}
+
+//the sql template functions,ph and param number the placeholder by the state
+func (h *DBHelper) templateFuncs(state *templateState) template.FuncMap {
+	return template.FuncMap{
+		"ph": func() string {
+			state.count++
+			if state.next < len(state.args) {
+				state.values = append(state.values, state.args[state.next])
+				state.next++
+			}
+			return h.metaHelper.ParamPlaceholder(state.count)
+		},
+		"param": func(name string) (string, error) {
+			v, ok := state.params[name]
+			if !ok {
+				return "", fmt.Errorf("the param %q not found", name)
+			}
+			state.count++
+			state.named = true
+			state.values = append(state.values, v)
+			return h.metaHelper.ParamPlaceholder(state.count), nil
+		},
+		"str": func(v string) string {
+			return h.metaHelper.StringExpress(v)
+		},
+		"reglike": func(value, strRegexp string) string {
+			return h.metaHelper.RegLike(value, strRegexp)
+		},
+		"strcat": func(values ...string) string {
+			return h.metaHelper.StringCat(values...)
+		},
+	}
+}
+func (h *DBHelper) parseTemplate(sql string) (*template.Template, error) {
+	return template.New("sql").Funcs(h.templateFuncs(&templateState{})).Parse(sql)
+}
+
+//SetTemplateCacheSize set the max number of the parsed sql templates cached,0 disable the cache.
+//the templates registered by RegisterTemplate are not limited by the size
+func (h *DBHelper) SetTemplateCacheSize(size int) {
+	h.templates.setCapacity(size)
+}
+func (h *DBHelper) TemplateCacheStats() TemplateCacheStats {
+	return h.templates.stats()
+}
+
+//RegisterTemplate parse the sql template and keep it in the cache forever,
+//the parse error is returned immediately,so it can be checked at startup.
+//use Template(name) to get the sql text
+func (h *DBHelper) RegisterTemplate(name, sql string) error {
+	t, err := h.parseTemplate(sql)
+	if err != nil {
+		return NewTemplateError(sql, err)
+	}
+	return h.templates.register(name, sql, t)
+}
+
+//Template return the sql text registered by RegisterTemplate
+func (h *DBHelper) Template(name string) (string, bool) {
+	return h.templates.named(name)
+}
@@ -0,0 +1,57 @@
+package dbhelper
+
+import (
+	"sync"
+	"testing"
+)
+
+func Test_templateCache(t *testing.T) {
+	h := NewDBHelper("postgres", "")
+	h.SetTemplateCacheSize(2)
+	strSql := "select * from t where a={{ph}} and b={{ph}}"
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rev, err := h.ConvertSql(strSql, nil); err != nil || rev != "select * from t where a=$1 and b=$2" {
+				t.Errorf("got %q,%v", rev, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if stats := h.TemplateCacheStats(); stats.Hits+stats.Misses != 10 || stats.Size != 1 {
+		t.Errorf("stats:%#v", stats)
+	}
+	for _, v := range []string{"select 1", "select 2", "select 3"} {
+		if _, err := h.ConvertSql(v, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := h.TemplateCacheStats(); stats.Size != 2 {
+		t.Errorf("the cache size %d,expect 2", stats.Size)
+	}
+}
+func Test_RegisterTemplate(t *testing.T) {
+	h := NewDBHelper("postgres", "")
+	if err := h.RegisterTemplate("bad", "select {{ph"); err == nil {
+		t.Error("parse error expected")
+	}
+	if err := h.RegisterTemplate("user", "select * from users where id={{ph}}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.RegisterTemplate("user", "select 1"); err == nil {
+		t.Error("duplicate name error expected")
+	}
+	strSql, ok := h.Template("user")
+	if !ok {
+		t.Fatal("the template user not found")
+	}
+	h.SetTemplateCacheSize(0)
+	if _, err := h.ConvertSql(strSql, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats := h.TemplateCacheStats(); stats.Hits != 1 || stats.Named != 1 {
+		t.Errorf("stats:%#v", stats)
+	}
+}
@@ -0,0 +1,94 @@
+package dbhelper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+//TxOptions is the options of InTx
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	//the max times to run the fn again when the error is retryable(deadlock,serialization failure...),
+	//0 not retry.the nested InTx never retry,the outermost does
+	MaxRetries int
+	//the wait before the first retry,doubled every retry,default 10ms
+	RetryDelay time.Duration
+}
+
+//the kind of the err,classified by the MetaHelper if it isn't a classified SqlError
+func (h *DBHelper) errorKind(err error) ErrorKind {
+	if k := ErrorKindOf(err); k != ErrorUnknown {
+		return k
+	}
+	if c, ok := h.metaHelper.(ErrorClassifier); ok {
+		return c.ClassifyError(err)
+	}
+	return ErrorUnknown
+}
+
+//InTx run the fn in a transaction,commit if fn return nil,rollback if fn return error or panic(the panic is repanicked).
+//the h passed to fn must be used in the fn,it is the DBHelper bind the transaction.
+//if the h has begun a transaction,the fn run in a savepoint,
+//or in the transaction directly if the MetaHelper isn't a SavepointBuilder
+func (h *DBHelper) InTx(fn func(h *DBHelper) error, opts *TxOptions) error {
+	return h.InTxContext(h.context(), fn, opts)
+}
+func (h *DBHelper) InTxContext(ctx context.Context, fn func(h *DBHelper) error, opts *TxOptions) error {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	delay := opts.RetryDelay
+	if delay <= 0 {
+		delay = 10 * time.Millisecond
+	}
+	for i := 0; ; i++ {
+		err := h.runTx(ctx, fn, opts)
+		if err == nil || h.tx != nil || i >= opts.MaxRetries || !h.errorKind(err).Retryable() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+func (h *DBHelper) runTx(ctx context.Context, fn func(h *DBHelper) error, opts *TxOptions) (err error) {
+	if !h.canBegin() {
+		return fn(h.WithContext(ctx))
+	}
+	var txOpts *sql.TxOptions
+	//嵌套的事务只是savepoint,不能设置隔离级别
+	if h.tx == nil {
+		txOpts = &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+	}
+	th, err := h.WithContext(ctx).BeginTx(ctx, txOpts)
+	if err != nil {
+		return
+	}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		if p := recover(); p != nil {
+			th.Rollback()
+			panic(p)
+		}
+		if rerr := th.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
+			err = fmt.Errorf("%v,and rollback fail:%v", err, rerr)
+		}
+	}()
+	if err = fn(th); err != nil {
+		return
+	}
+	if err = th.Commit(); err != nil {
+		return
+	}
+	committed = true
+	return
+}
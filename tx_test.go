@@ -0,0 +1,78 @@
+package dbhelper
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_InTx(t *testing.T) {
+	fakeReset()
+	defer fakeReset()
+	h := NewDBHelper(fakeDriverName, "")
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	calls := 0
+	err := h.InTx(func(th *DBHelper) error {
+		calls++
+		if th.tx == nil {
+			t.Error("the fn not run in the trans")
+		}
+		if calls == 1 {
+			return errors.New("database is locked")
+		}
+		return nil
+	}, &TxOptions{MaxRetries: 2, RetryDelay: time.Millisecond})
+	if err != nil || calls != 2 {
+		t.Errorf("retry fail,calls %d,err %v", calls, err)
+	}
+	if h.tx != nil {
+		t.Error("the trans of h should not be changed")
+	}
+
+	calls = 0
+	err = h.InTx(func(th *DBHelper) error {
+		calls++
+		return errors.New("other")
+	}, &TxOptions{MaxRetries: 2})
+	if err == nil || calls != 1 {
+		t.Errorf("the error not retryable should return,calls %d,err %v", calls, err)
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("the panic should be repanicked,got %v", p)
+			}
+		}()
+		h.InTx(func(th *DBHelper) error {
+			panic("boom")
+		}, nil)
+	}()
+}
+
+func Test_BeginScoped(t *testing.T) {
+	h := NewDBHelper(fakeDriverName, "")
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	th, err := h.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.tx != nil || th.tx == nil {
+		t.Error("the trans should bind to the returned DBHelper only")
+	}
+	if th.metaHelper == h.metaHelper {
+		t.Error("the DBHelper of the trans should have its own MetaHelper")
+	}
+	if err := th.Close(); err == nil {
+		t.Error("close the DBHelper of the trans should fail")
+	}
+	if err := th.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}